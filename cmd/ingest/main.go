@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/ingest"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	tlds := flag.String("tld", "", "comma-separated TLDs to ingest, empty for every TLD with an axfr source")
+	date := flag.String("date", time.Now().UTC().Format("20060102"), "snapshot date as YYYYMMDD")
+	flag.Parse()
+
+	if err := logging.Setup(); err != nil {
+		slog.Error("invalid logging config", logging.Err(err))
+		os.Exit(1)
+	}
+
+	day, err := time.Parse("20060102", *date)
+	if err != nil {
+		slog.Error("invalid date", slog.String("date", *date), logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(os.Getenv("TLD_CONFIG"))
+	if err != nil {
+		slog.Error("failed to load TLD config", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var targets []string
+	if *tlds != "" {
+		targets = strings.Split(*tlds, ",")
+	} else {
+		for _, name := range cfg.Names() {
+			if cfg.TLDs[name].AXFR != nil {
+				targets = append(targets, name)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		slog.Error("no TLDs with an axfr source configured")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pools := database.NewPools()
+	defer pools.Close()
+
+	failed := 0
+	var ingested []string
+	for _, tld := range targets {
+		result, err := ingest.Run(ctx, pools, cfg, tld, day)
+		if err != nil {
+			slog.Error("ingestion failed", slog.String("tld", tld), logging.Err(err))
+			failed++
+			continue
+		}
+		slog.Info("ingested", slog.String("tld", tld), slog.Int("date", result.Date), slog.Int("domains", result.Total),
+			slog.Int("added", result.Added), slog.Int("removed", result.Removed), slog.Bool("bootstrap", result.Bootstrap))
+		ingested = append(ingested, tld)
+	}
+
+	if len(ingested) > 0 {
+		invalidateCaches(ctx, cfg.Cache, ingested)
+	}
+
+	if failed > 0 {
+		pools.Close()
+		os.Exit(1)
+	}
+}
+
+// invalidateCaches drops the cached responses of the ingested TLDs from a shared Redis cache, which
+// announces the invalidation to every server. Memory caches are local to each server, which drops
+// them itself once it sees the new dates row, see cache.watch.
+func invalidateCaches(ctx context.Context, cfg config.Cache, tlds []string) {
+	if cfg.Backend != config.CacheRedis && cfg.Backend != config.CacheTiered {
+		slog.Info("no shared cache to invalidate, servers drop cached responses on their next check", slog.String("backend", cfg.Backend))
+		return
+	}
+
+	c, err := cache.NewRedis(ctx, cfg.Redis)
+	if err != nil {
+		slog.Warn("cache invalidation skipped", logging.Err(err))
+		return
+	}
+	defer c.Close()
+
+	for _, tld := range tlds {
+		if err := c.Invalidate(ctx, cache.TLDTag(tld)); err != nil {
+			slog.Warn("cache invalidation failed", slog.String("tld", tld), logging.Err(err))
+			continue
+		}
+		slog.Info("invalidated cached responses", slog.String("tld", tld))
+	}
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return config.FromEnv()
+	}
+	return config.Load(path)
+}
@@ -1,13 +1,75 @@
 package main
 
 import (
+	"context"
 	"go-axfr-backend/internal/api"
-	"log"
-	"net/http"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/server"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	api.InitRedis()
-	mux := api.SetupRoutes()
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	if err := logging.Setup(); err != nil {
+		slog.Error("invalid logging config", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg, err := server.FromEnv()
+	if err != nil {
+		slog.Error("invalid server config", logging.Err(err))
+		os.Exit(1)
+	}
+
+	api.InitTLDRegistry()
+	api.InitCache()
+	api.InitCacheWatch()
+	api.InitAuth()
+	api.InitRateLimit()
+	api.InitTracing()
+	api.InitSearchIndexes()
+
+	srv, err := server.New(cfg, api.SetupRoutes(), api.SetupAdminRoutes())
+	if err != nil {
+		slog.Error("failed to set up server", logging.Err(err))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		// A second signal kills the process instead of waiting for the drain.
+		<-ctx.Done()
+		stop()
+	}()
+
+	runErr := srv.Run(ctx, api.Drain)
+	if runErr != nil {
+		slog.Error("server stopped", logging.Err(runErr))
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	api.CloseSearchIndexes()
+	api.CloseCacheWatch()
+	if err := api.ClosePools(); err != nil {
+		slog.Error("database pool shutdown failed", logging.Err(err))
+	}
+	if err := api.CloseCache(); err != nil {
+		slog.Error("cache shutdown failed", logging.Err(err))
+	}
+	if err := api.CloseAuth(); err != nil {
+		slog.Error("API key backend shutdown failed", logging.Err(err))
+	}
+	if err := api.CloseRateLimit(); err != nil {
+		slog.Error("rate limiter shutdown failed", logging.Err(err))
+	}
+	if err := api.CloseTracing(closeCtx); err != nil {
+		slog.Error("tracing shutdown failed", logging.Err(err))
+	}
+	if runErr != nil {
+		os.Exit(1)
+	}
 }
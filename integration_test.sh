@@ -88,7 +88,24 @@ cat > test_data/nu_0.json << 'EOF'
 [
   {
     "date": 20250314,
-    "amount": 44
+    "amount": 44,
+    "added": 44,
+    "removed": 3
+  }
+]
+EOF
+
+# Test 1b: /removed/nu/20250314/0 endpoint
+cat > test_data/removed.json << 'EOF'
+[
+  {
+    "domain": "gammal.nu"
+  },
+  {
+    "domain": "nedlagd.nu"
+  },
+  {
+    "domain": "utgangen.nu"
   }
 ]
 EOF
@@ -197,19 +214,96 @@ cat > test_data/appearance.json << 'EOF'
 }
 EOF
 
+# Test 6: /history/nu/digitalisering.nu endpoint
+cat > test_data/history.json << 'EOF'
+{
+  "domain": "digitalisering.nu",
+  "registered": false,
+  "first_seen": "2025-03-14",
+  "registrations": 1,
+  "intervals": [
+    {
+      "added": "2025-03-14",
+      "removed": null
+    }
+  ]
+}
+EOF
+
+# Test 7: /domains/nu/20250314?limit=2 endpoint
+cat > test_data/nudomains_cursor.json << 'EOF'
+[
+  "badrumonline.nu",
+  "badrumsdeal.nu"
+]
+EOF
+
+# Test 8: /search/nu/01?mode=prefix&limit=3 endpoint
+cat > test_data/search_prefix.json << 'EOF'
+{
+  "items": [
+    {
+      "domain": "01.nu"
+    },
+    {
+      "domain": "010.nu"
+    },
+    {
+      "domain": "010acupunctuur.nu"
+    }
+  ],
+  "next": "eyJkIjowLCJrIjoiMDEwYWN1cHVuY3R1dXIubnUifQ",
+  "prev": null
+}
+EOF
+
 # Run the tests
 failed_tests=0
 
 test_endpoint "/nu/0" "test_data/nu_0.json" "NU domains count" || failed_tests=$((failed_tests + 1))
 test_endpoint "/nudomains/20250314/1" "test_data/nudomains.json" "NU domains list for date 20250314 page 1" || failed_tests=$((failed_tests + 1))
+test_endpoint "/dates/nu/0" "test_data/nu_0.json" "NU domains count (generic route)" || failed_tests=$((failed_tests + 1))
+test_endpoint "/domains/nu/20250314/1" "test_data/nudomains.json" "NU domains list for date 20250314 page 1 (generic route)" || failed_tests=$((failed_tests + 1))
+test_endpoint "/removed/nu/20250314/0" "test_data/removed.json" "NU removed domains for date 20250314 page 0" || failed_tests=$((failed_tests + 1))
 test_endpoint "/search/nu/010" "test_data/search.json" "Search NU domains with '010'" || failed_tests=$((failed_tests + 1))
+test_endpoint "/search/nu/01?mode=prefix&limit=3" "test_data/search_prefix.json" "Prefix search NU domains with '01'" || failed_tests=$((failed_tests + 1))
 test_endpoint "/stats/nu" "test_data/stats.json" "NU domains statistics" || failed_tests=$((failed_tests + 1))
 test_endpoint "/nuappearance/digitalisering.nu" "test_data/appearance.json" "First appearance of digitalisering.nu" || failed_tests=$((failed_tests + 1))
+test_endpoint "/history/nu/digitalisering.nu" "test_data/history.json" "History of digitalisering.nu" || failed_tests=$((failed_tests + 1))
+
+echo "🧪 Testing NU domains list with cursor pagination..."
+cursor_page=$(curl -s "http://$APP_IP:8080/domains/nu/20250314?limit=2")
+if echo "$cursor_page" | jq '[.items[].domain]' | diff -w - test_data/nudomains_cursor.json > /dev/null; then
+    next_cursor=$(echo "$cursor_page" | jq -r '.next')
+    next_first=$(curl -s "http://$APP_IP:8080/domains/nu/20250314?limit=2&cursor=$next_cursor" | jq -r '.items[0].domain')
+    if [ "$next_first" == "badrumsproffs.nu" ]; then
+        echo "✅ Test passed: NU domains list with cursor pagination"
+    else
+        echo "❌ Test failed: next page starts with $next_first"
+        failed_tests=$((failed_tests + 1))
+    fi
+else
+    echo "❌ Test failed: NU domains list with cursor pagination"
+    echo "$cursor_page"
+    failed_tests=$((failed_tests + 1))
+fi
+
+echo "🧪 Testing error envelope for an unknown TLD..."
+error_status=$(curl -s -o /tmp/error_body.json -w "%{http_code}" "http://$APP_IP:8080/dates/xx/0")
+error_code=$(jq -r '.error.code' /tmp/error_body.json)
+if [ "$error_status" == "404" ] && [ "$error_code" == "unknown_tld" ]; then
+    echo "✅ Test passed: error envelope for an unknown TLD"
+else
+    echo "❌ Test failed: got status $error_status and code $error_code"
+    failed_tests=$((failed_tests + 1))
+fi
+rm -f /tmp/error_body.json
 
 # Run cache tests
 echo "ℹ️ Running cache tests..."
 test_cache_hit "/nu/0" "NU domains count" || failed_tests=$((failed_tests + 1))
 test_cache_hit "/nudomains/20250314/1" "NU domains list for date 20250314 page 1" || failed_tests=$((failed_tests + 1))
+test_cache_hit "/removed/nu/20250314/0" "NU removed domains for date 20250314 page 0" || failed_tests=$((failed_tests + 1))
 test_cache_hit "/search/nu/010" "Search NU domains with '010'" || failed_tests=$((failed_tests + 1))
 test_cache_hit "/stats/nu" "NU domains statistics" || failed_tests=$((failed_tests + 1))
 test_cache_hit "/nuappearance/digitalisering.nu" "First appearance of digitalisering.nu" || failed_tests=$((failed_tests + 1))
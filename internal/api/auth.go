@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go-axfr-backend/internal/auth"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// authenticator checks API keys; nil when no key backend is configured and every endpoint is open.
+var authenticator *auth.Authenticator
+
+type apiKeyKey struct{}
+
+// apiKey returns the key Middleware authenticated r with, or nil for anonymous requests.
+func apiKey(r *http.Request) *auth.Key {
+	key, _ := r.Context().Value(apiKeyKey{}).(*auth.Key)
+	return key
+}
+
+// InitAuth sets up the API key backend and quota counters selected in the config. Unlike the cache,
+// a key backend that cannot be set up stops the server rather than leaving endpoints open.
+func InitAuth() {
+	cfg := tldRegistry.Config()
+	if cfg.Auth.Backend == config.AuthNone {
+		return
+	}
+
+	var store auth.Store
+	switch cfg.Auth.Backend {
+	case config.AuthFile:
+		fileStore, err := auth.NewFileStore(cfg.Auth.File)
+		if err != nil {
+			slog.Error("failed to load API keys", logging.Err(err))
+			os.Exit(1)
+		}
+		fileStore.ReloadOnSignal(syscall.SIGHUP)
+		store = fileStore
+	case config.AuthMySQL:
+		db, err := dbPools.Get(ctx, *cfg.Auth.Database, cfg.Pool)
+		if err != nil {
+			slog.Error("failed to connect to the API key database", logging.Err(err))
+			os.Exit(1)
+		}
+		store = auth.NewMySQLStore(db)
+	}
+
+	var quotas auth.Quotas = auth.NewMemoryQuotas()
+	if cfg.Auth.Quotas == config.QuotaRedis {
+		quotas = auth.NewRedisQuotas(cfg.Cache.Redis)
+	}
+
+	authenticator = &auth.Authenticator{Store: store, Quotas: quotas, Required: cfg.Auth.Required}
+	slog.Info("API keys enabled", slog.String("backend", cfg.Auth.Backend), slog.String("quotas", cfg.Auth.Quotas), slog.Bool("required", cfg.Auth.Required))
+}
+
+// CloseAuth releases the key backend and quota counters, for use on server shutdown.
+func CloseAuth() error {
+	if authenticator == nil {
+		return nil
+	}
+	return errors.Join(authenticator.Store.Close(), authenticator.Quotas.Close())
+}
+
+// authenticate returns r carrying its API key, or the error to answer it with. The key's quotas are
+// charged separately by chargeQuota, once the request has passed the rate limiter.
+func authenticate(r *http.Request) (*http.Request, error) {
+	if authenticator == nil {
+		return r, nil
+	}
+	key, err := authenticator.Identify(r.Context(), r)
+	if err != nil {
+		return r, authError(err, auth.FromRequest(r) != "")
+	}
+	if key == nil {
+		return r, nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)), nil
+}
+
+// chargeQuota counts r against the quotas of its API key, if any, and returns the error to answer
+// it with once one is used up.
+func chargeQuota(r *http.Request) error {
+	key := apiKey(r)
+	if authenticator == nil || key == nil {
+		return nil
+	}
+	if err := authenticator.Charge(r.Context(), key); err != nil {
+		return authError(err, true)
+	}
+	return nil
+}
+
+// authError maps authentication failures to API errors: 401 without a valid key, 403 for a disabled
+// key, 429 once a quota is used up and 503 when the key or quota backend fails.
+func authError(err error, sent bool) error {
+	var quota *auth.QuotaExceededError
+	switch {
+	case errors.Is(err, auth.ErrUnknownKey) && !sent:
+		return &apiError{status: http.StatusUnauthorized, code: "missing_api_key", message: "an API key is required"}
+	case errors.Is(err, auth.ErrUnknownKey):
+		return &apiError{status: http.StatusUnauthorized, code: "invalid_api_key", message: "invalid API key"}
+	case errors.Is(err, auth.ErrDisabled):
+		return &apiError{status: http.StatusForbidden, code: "api_key_disabled", message: "API key is disabled"}
+	case errors.As(err, &quota):
+		return &apiError{status: http.StatusTooManyRequests, code: "quota_exceeded", message: quota.Error(), retryAt: quota.Reset}
+	default:
+		return &apiError{status: http.StatusServiceUnavailable, code: "auth_unavailable", message: "API key check failed", cause: err}
+	}
+}
+
+// RequireScope serves next only for keys granted scope. Without a key backend every request passes;
+// the admin routes are then protected only by the admin listener, see SetupAdminRoutes.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticator == nil {
+			next(w, r)
+			return
+		}
+		key := apiKey(r)
+		if key == nil {
+			writeError(w, r, authError(auth.ErrUnknownKey, false))
+			return
+		}
+		if !key.HasScope(scope) {
+			writeError(w, r, &apiError{status: http.StatusForbidden, code: "insufficient_scope", message: "API key lacks the " + scope + " scope"})
+			return
+		}
+		next(w, r)
+	}
+}
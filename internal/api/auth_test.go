@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"go-axfr-backend/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMiddlewareAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	os.WriteFile(path, []byte(`
+keys:
+  - {name: partner, key_sha256: `+auth.Hash("partner-key")+`, enabled: true, daily_quota: 2}
+  - {name: ops, key_sha256: `+auth.Hash("ops-key")+`, enabled: true, scopes: [admin]}
+  - {name: gone, key_sha256: `+auth.Hash("gone-key")+`, enabled: false}
+`), 0o600)
+	store, err := auth.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(t, &authenticator, &auth.Authenticator{Store: store, Quotas: auth.NewMemoryQuotas()})
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) }
+	public := Middleware(ok)
+	admin := Middleware(RequireScope(auth.ScopeAdmin, ok))
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		header     string
+		value      string
+		wantStatus int
+		wantCode   string
+	}{
+		{"anonymous public", public, "", "", http.StatusOK, ""},
+		{"keyed public", public, auth.Header, "partner-key", http.StatusOK, ""},
+		{"unknown key", public, auth.Header, "guess", http.StatusUnauthorized, "invalid_api_key"},
+		{"disabled key", public, "Authorization", "Bearer gone-key", http.StatusForbidden, "api_key_disabled"},
+		{"anonymous admin", admin, "", "", http.StatusUnauthorized, "missing_api_key"},
+		{"admin without scope", admin, auth.Header, "partner-key", http.StatusForbidden, "insufficient_scope"},
+		{"admin with scope", admin, "Authorization", "Bearer ops-key", http.StatusOK, ""},
+		{"over quota", public, auth.Header, "partner-key", http.StatusTooManyRequests, "quota_exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+
+			var body struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if rr.Code != tt.wantStatus || body.Error.Code != tt.wantCode {
+				t.Errorf("got %d %q, want %d %q", rr.Code, body.Error.Code, tt.wantStatus, tt.wantCode)
+			}
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+				t.Error("429 without Retry-After")
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestRequireScopeWithoutKeys(t *testing.T) {
+	swap(t, &authenticator, nil)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) }
+
+	// The admin listener is the trust boundary when there are no keys.
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+	}{
+		{"bulk", RequireScope(auth.ScopeBulk, ok), "/"},
+		{"admin", RequireScope(auth.ScopeAdmin, ok), "/"},
+		{"admin route on the admin listener", SetupAdminRoutes(), "/admin/pools"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("GET %s = %d, want 200", tt.path, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/metrics"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// X-Cache values. STALE responses are past their soft TTL and are being refreshed in the background;
+// COALESCED responses were generated once for several concurrent misses.
+const (
+	cacheHit       = "HIT"
+	cacheMiss      = "MISS"
+	cacheStale     = "STALE"
+	cacheCoalesced = "COALESCED"
+)
+
+// hardTTLFactor sets how long an entry is kept past its soft TTL: an entry with soft TTL ttl is
+// served stale until ttl*hardTTLFactor, after which the cache expires it and readers wait for a refresh.
+const hardTTLFactor = 2
+
+// cacheEntryMagic prefixes encoded entries so values written by older versions are treated as misses.
+const cacheEntryMagic = "AXC1"
+
+// cacheEntry is the value stored under a cache key: the response and when it was generated.
+type cacheEntry struct {
+	GeneratedAt time.Time
+	SoftTTL     time.Duration
+	Data        []byte
+}
+
+func (e cacheEntry) encode() []byte {
+	buf := make([]byte, 0, len(cacheEntryMagic)+16+len(e.Data))
+	buf = append(buf, cacheEntryMagic...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.GeneratedAt.UnixNano()))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.SoftTTL))
+	return append(buf, e.Data...)
+}
+
+func decodeCacheEntry(raw []byte) (cacheEntry, bool) {
+	const header = len(cacheEntryMagic) + 16
+	if len(raw) < header || string(raw[:len(cacheEntryMagic)]) != cacheEntryMagic {
+		return cacheEntry{}, false
+	}
+	raw = raw[len(cacheEntryMagic):]
+	return cacheEntry{
+		GeneratedAt: time.Unix(0, int64(binary.BigEndian.Uint64(raw[:8]))),
+		SoftTTL:     time.Duration(binary.BigEndian.Uint64(raw[8:16])),
+		Data:        raw[16:],
+	}, true
+}
+
+func (e cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.GeneratedAt.Add(e.SoftTTL))
+}
+
+// flight is one in-progress generation of a cache key.
+type flight struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// flightGroup runs at most one generator per key at a time, singleflight-style.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// do runs fn for key, or joins the call already in flight and shares its result, in which case
+// coalesced is set. fn runs in the background so it is not tied to any one caller: a caller whose
+// ctx ends stops waiting with ctx's error while the call goes on for the others.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) (data []byte, coalesced bool, err error) {
+	g.mu.Lock()
+	c, coalesced := g.calls[key]
+	if !coalesced {
+		c = g.begin(key)
+		go g.run(key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.data, coalesced, c.err
+	case <-ctx.Done():
+		return nil, coalesced, ctx.Err()
+	}
+}
+
+// start runs fn for key in the background unless a call for key is already in flight.
+func (g *flightGroup) start(key string, fn func() ([]byte, error)) bool {
+	g.mu.Lock()
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	c := g.begin(key)
+	g.mu.Unlock()
+
+	go g.run(key, c, fn)
+	return true
+}
+
+// wait waits for the call in flight for key and returns its result. inFlight is false, and nothing
+// is waited for, when there is none.
+func (g *flightGroup) wait(ctx context.Context, key string) (data []byte, inFlight bool, err error) {
+	g.mu.Lock()
+	c, inFlight := g.calls[key]
+	g.mu.Unlock()
+	if !inFlight {
+		return nil, false, nil
+	}
+
+	select {
+	case <-c.done:
+		return c.data, true, c.err
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+}
+
+// begin registers a call for key; g.mu must be held.
+func (g *flightGroup) begin(key string) *flight {
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	c := &flight{done: make(chan struct{})}
+	g.calls[key] = c
+	return c
+}
+
+func (g *flightGroup) run(key string, c *flight, fn func() ([]byte, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.data, c.err = fn()
+}
+
+var cacheFlights flightGroup
+
+// generateAndStore runs generator and, when it succeeds, caches the result under tags with soft
+// TTL ttl for ttl*hardTTLFactor. Errors are never cached.
+func generateAndStore(ctx context.Context, key string, ttl time.Duration, tags []string, generator func(context.Context) ([]byte, error)) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "cache.generate", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer span.End()
+
+	data, err := generator(ctx)
+	if err != nil {
+		failSpan(span, err)
+		return nil, err
+	}
+
+	entry := cacheEntry{GeneratedAt: time.Now(), SoftTTL: ttl, Data: data}
+	if err := responseCache.Set(ctx, key, entry.encode(), ttl*hardTTLFactor, tags...); err != nil {
+		slog.WarnContext(ctx, "cache set failed", slog.String("key", key), logging.Err(err))
+	}
+	return data, nil
+}
+
+// cacheKeyPrefix returns the part of a cache key before the first colon, e.g. "sedates" or "stats",
+// which names the listing without the unbounded page, date or query parts.
+func cacheKeyPrefix(key string) string {
+	prefix, _, _ := strings.Cut(key, ":")
+	return prefix
+}
+
+// getOrSetCache returns the cached value for key and its X-Cache status. Fresh entries are HIT;
+// entries past their soft TTL are returned as STALE while one background refresh runs. Misses are
+// generated once per key, concurrent misses wait for that run and are COALESCED. Generator errors
+// are returned without caching anything; cache backend failures are logged and served uncached.
+func getOrSetCache(ctx context.Context, key string, ttl time.Duration, tags []string, generator func(context.Context) ([]byte, error)) (data []byte, status string, err error) {
+	ctx, span := tracer.Start(ctx, "cache.getOrSet", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer func() {
+		span.SetAttributes(attribute.String("cache.status", status))
+		if err != nil {
+			failSpan(span, err)
+		}
+		span.End()
+	}()
+
+	prefix := cacheKeyPrefix(key)
+
+	lookupCtx, lookup := tracer.Start(ctx, "cache.get")
+	raw, err := responseCache.Get(lookupCtx, key)
+	if err != nil && !errors.Is(err, cache.ErrMiss) {
+		failSpan(lookup, err)
+	}
+	lookup.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	lookup.End()
+
+	switch {
+	case err == nil:
+		if entry, ok := decodeCacheEntry(raw); ok {
+			if entry.fresh(time.Now()) {
+				slog.DebugContext(ctx, "cache hit", slog.String("key", key))
+				metrics.CacheRequests.WithLabelValues(prefix, "hit").Inc()
+				return entry.Data, cacheHit, nil
+			}
+			if cacheFlights.start(key, func() ([]byte, error) {
+				// The refresh outlives the request, so it gets its own trace linked to the request's.
+				refreshCtx, refresh := tracer.Start(context.WithoutCancel(ctx), "cache.refresh",
+					trace.WithNewRoot(), trace.WithLinks(trace.LinkFromContext(ctx)))
+				defer refresh.End()
+				data, err := generateAndStore(refreshCtx, key, ttl, tags, generator)
+				if err != nil {
+					slog.WarnContext(refreshCtx, "background refresh failed", slog.String("key", key), logging.Err(err))
+				}
+				return data, err
+			}) {
+				slog.DebugContext(ctx, "cache stale, refreshing", slog.String("key", key))
+			}
+			metrics.CacheRequests.WithLabelValues(prefix, "stale").Inc()
+			return entry.Data, cacheStale, nil
+		}
+		// Values without an entry header predate stale-while-revalidate and count as misses.
+		slog.DebugContext(ctx, "cache miss", slog.String("key", key))
+	case errors.Is(err, cache.ErrMiss):
+		slog.DebugContext(ctx, "cache miss", slog.String("key", key))
+	default:
+		slog.WarnContext(ctx, "cache get failed", slog.String("key", key), logging.Err(err))
+		metrics.CacheRequests.WithLabelValues(prefix, "error").Inc()
+	}
+
+	// The generation is shared by every caller coalesced onto it, so it must not end with the
+	// request that happened to start it.
+	data, coalesced, err := cacheFlights.do(ctx, key, func() ([]byte, error) {
+		return generateAndStore(context.WithoutCancel(ctx), key, ttl, tags, generator)
+	})
+	if coalesced {
+		metrics.CacheRequests.WithLabelValues(prefix, "coalesced").Inc()
+	} else {
+		metrics.CacheRequests.WithLabelValues(prefix, "miss").Inc()
+	}
+	if err != nil {
+		return nil, cacheMiss, err
+	}
+	if coalesced {
+		return data, cacheCoalesced, nil
+	}
+	return data, cacheMiss, nil
+}
+
+// serveCached writes the cached or generated response for key in the format and content coding the
+// request negotiated, or the error envelope when generating it failed. Each format and coding is
+// cached under its own key. tags, see cache.Tags, let ingestion invalidate the response.
+func serveCached[T any](w http.ResponseWriter, r *http.Request, key string, ttl time.Duration, tags []string, generator func(context.Context) (T, error)) {
+	f, err := negotiateFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	encode := encodeWith(f, generator)
+	var links cursorLinker
+	if _, paged := any(*new(T)).(cursorLinker); paged && f.name != formatJSON {
+		// Other formats are derived from the cached JSON page, the only one that keeps its cursors,
+		// and send them as a Link header.
+		jsonFormat, _ := lookupFormat(formatJSON)
+		page, _, err := getOrSetCompressed(r.Context(), key+":"+formatJSON, "", ttl, tags, encodeWith(jsonFormat, generator))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		var cursors keysetPage[struct{}]
+		if err := json.Unmarshal(page, &cursors); err != nil {
+			writeError(w, r, errEncode(err))
+			return
+		}
+		links = cursors
+		encode = func(context.Context) ([]byte, error) {
+			var v T
+			if err := json.Unmarshal(page, &v); err != nil {
+				return nil, errEncode(err)
+			}
+			data, err := f.encode(v)
+			if err != nil {
+				return nil, errEncode(err)
+			}
+			return data, nil
+		}
+	}
+
+	coding := negotiateEncoding(r)
+	result, status, err := getOrSetCompressed(r.Context(), key+":"+f.name, coding, ttl, tags, encode)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setFormatHeaders(w, f)
+	setEncodingHeaders(w, coding)
+	if links != nil {
+		setPageLinks(w, r, links)
+	}
+	w.Header().Set("X-Cache", status)
+	w.Write(result)
+}
+
+// encodeWith returns a cache generator encoding the value of generator in f.
+func encodeWith[T any](f responseFormat, generator func(context.Context) (T, error)) func(context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		v, err := generator(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := f.encode(v)
+		if err != nil {
+			return nil, errEncode(err)
+		}
+		return data, nil
+	}
+}
+
+// invalidateCache drops every cached response of a TLD, or of one of its datasets, on all nodes
+// sharing the cache: POST /admin/cache/invalidate/{tld}[/{dump|diff}].
+func invalidateCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, methodNotAllowed(http.MethodPost))
+		return
+	}
+
+	parts, err := getPathParams(r.URL.Path, 4)
+	if err != nil {
+		if parts, err = getPathParams(r.URL.Path, 5); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	tld := parts[3]
+	if _, ok := tldRegistry.Lookup(tld); !ok {
+		writeError(w, r, notFound("unknown_tld", "unsupported TLD: "+tld))
+		return
+	}
+
+	tag := cache.TLDTag(tld)
+	if len(parts) == 5 {
+		dataset := parts[4]
+		if dataset != cache.DatasetDump && dataset != cache.DatasetDiff {
+			writeError(w, r, badRequest("invalid_dataset", "dataset must be dump or diff"))
+			return
+		}
+		tag = cache.DatasetTag(tld, dataset)
+	}
+
+	if err := responseCache.Invalidate(ctx, tag); err != nil {
+		writeError(w, r, internalError("cache_unavailable", "cache invalidation failed", err))
+		return
+	}
+	slog.InfoContext(r.Context(), "invalidated cached responses", slog.String("tag", tag))
+
+	writeValue(w, r, struct {
+		Invalidated string `json:"invalidated"`
+	}{tag})
+}
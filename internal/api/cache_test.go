@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheEntryRoundTrip(t *testing.T) {
+	generated := time.Unix(1742000000, 123)
+	entry := cacheEntry{GeneratedAt: generated, SoftTTL: MediumTTL, Data: []byte(`[{"domain":"a.se"}]`)}
+
+	got, ok := decodeCacheEntry(entry.encode())
+	if !ok {
+		t.Fatal("decodeCacheEntry() ok = false")
+	}
+	if !got.GeneratedAt.Equal(generated) || got.SoftTTL != MediumTTL || !bytes.Equal(got.Data, entry.Data) {
+		t.Errorf("decodeCacheEntry() = %+v, want %+v", got, entry)
+	}
+	if !got.fresh(generated.Add(time.Minute)) || got.fresh(generated.Add(MediumTTL)) {
+		t.Errorf("fresh() should hold for the soft TTL only")
+	}
+
+	if _, ok := decodeCacheEntry([]byte(`[{"domain":"a.se"}]`)); ok {
+		t.Error("decodeCacheEntry() accepted a value without header")
+	}
+}
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	const waiters = 5
+	var wg sync.WaitGroup
+	var coalesced atomic.Int32
+	results := make(chan string, waiters+1)
+
+	leaderStarted := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		data, shared, _ := g.do(context.Background(), "k", func() ([]byte, error) {
+			calls.Add(1)
+			close(leaderStarted)
+			<-release
+			return []byte("v"), nil
+		})
+		if shared {
+			coalesced.Add(1)
+		}
+		results <- string(data)
+	}()
+	<-leaderStarted
+
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, shared, _ := g.do(context.Background(), "k", func() ([]byte, error) {
+				calls.Add(1)
+				return []byte("other"), nil
+			})
+			if shared {
+				coalesced.Add(1)
+			}
+			results <- string(data)
+		}()
+	}
+
+	// Waiters block on the leader; give them time to join before releasing it.
+	time.Sleep(20 * time.Millisecond)
+	if g.start("k", func() ([]byte, error) { calls.Add(1); return nil, nil }) {
+		t.Error("start() ran while a call was in flight")
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls.Load() != 1 {
+		t.Errorf("generator ran %d times, want 1", calls.Load())
+	}
+	if coalesced.Load() != waiters {
+		t.Errorf("coalesced = %d, want %d", coalesced.Load(), waiters)
+	}
+	for data := range results {
+		if data != "v" {
+			t.Errorf("result = %q, want the leader's", data)
+		}
+	}
+}
+
+func TestFlightGroupOutlivesCanceledCaller(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(leaderCtx, "k", func() ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("v"), nil
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan string, 1)
+	go func() {
+		data, _, err := g.do(context.Background(), "k", func() ([]byte, error) { return []byte("other"), nil })
+		if err != nil {
+			waiter <- err.Error()
+			return
+		}
+		waiter <- string(data)
+	}()
+
+	// The leader's client goes away: it stops waiting, the generation and the waiter carry on.
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller got %v, want context.Canceled", err)
+	}
+	// Give the waiter time to join before releasing the generation.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if got := <-waiter; got != "v" {
+		t.Errorf("waiter got %q, want the shared result", got)
+	}
+}
+
+func TestServeCachedWithoutCache(t *testing.T) {
+	swap[cache.Cache](t, &responseCache, cache.Nop{})
+
+	rr := httptest.NewRecorder()
+	serveCached(rr, httptest.NewRequest(http.MethodGet, "/stats/se", nil), "stats:se", ShortTTL, cache.Tags("se", cache.DatasetDump), func(context.Context) ([]int, error) {
+		return []int{}, nil
+	})
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != cacheMiss || rr.Body.String() != `[]` {
+		t.Errorf("got %d %q %q, want a MISS with the generated body", rr.Code, rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+
+	_, status, err := getOrSetCache(context.Background(), "stats:se", ShortTTL, cache.Tags("se", cache.DatasetDump), func(context.Context) ([]byte, error) {
+		return nil, errors.New("boom")
+	})
+	if err == nil || status != cacheMiss {
+		t.Errorf("getOrSetCache() = %q, %v, want the generator error", status, err)
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Dump: &config.Database{Name: "sedump"}, Endpoints: []string{config.EndpointStats}},
+	}}))
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+
+	mem.Set(ctx, "stats:se", []byte("[]"), 0, cache.Tags("se", cache.DatasetDump)...)
+	mem.Set(ctx, "sedates:page:0", []byte("[]"), 0, cache.Tags("se", cache.DatasetDiff)...)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantLen    int
+	}{
+		{method: http.MethodGet, path: "/admin/cache/invalidate/se", wantStatus: http.StatusMethodNotAllowed, wantLen: 2},
+		{method: http.MethodPost, path: "/admin/cache/invalidate/xx", wantStatus: http.StatusNotFound, wantLen: 2},
+		{method: http.MethodPost, path: "/admin/cache/invalidate/se/zone", wantStatus: http.StatusBadRequest, wantLen: 2},
+		{method: http.MethodPost, path: "/admin/cache/invalidate/se/dump", wantStatus: http.StatusOK, wantLen: 1},
+		{method: http.MethodPost, path: "/admin/cache/invalidate/se", wantStatus: http.StatusOK, wantLen: 0},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		Middleware(invalidateCache)(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rr.Code, tt.wantStatus)
+		}
+		if mem.Len() != tt.wantLen {
+			t.Errorf("%s %s left %d entries, want %d", tt.method, tt.path, mem.Len(), tt.wantLen)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"time"
+)
+
+// cacheWatch stops the loop started by InitCacheWatch; done is closed once it has.
+var cacheWatch struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// datasetVersion returns the id of a database's latest dates row. Every load of a dump or diff adds
+// one, so the id identifies the data.
+var datasetVersion = func(ctx context.Context, cfg config.Database) (int64, error) {
+	db, err := dbConn(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = database.QueryRow(ctx, db, "SELECT COALESCE(MAX(id), 0) FROM dates").Scan(&version)
+	return version, err
+}
+
+// InitCacheWatch drops the cached responses of a dataset every time new data lands in it, checked
+// every cache.watch. This covers the memory cache, which cmd/ingest cannot reach.
+func InitCacheWatch() {
+	interval := tldRegistry.Config().Cache.Watch
+	if interval <= 0 {
+		return
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	cacheWatch.stop, cacheWatch.done = stop, done
+
+	go func() {
+		defer close(done)
+		versions := make(map[string]int64)
+		for {
+			checkDatasets(ctx, versions)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// CloseCacheWatch stops the loop started by InitCacheWatch, for use on server shutdown.
+func CloseCacheWatch() {
+	if cacheWatch.stop == nil {
+		return
+	}
+	cacheWatch.stop()
+	<-cacheWatch.done
+	cacheWatch.stop, cacheWatch.done = nil, nil
+}
+
+// checkDatasets compares the version of every dump and diff database with the one in versions,
+// keyed by cache tag, and invalidates the tag of each that changed. The first check of a dataset
+// only records its version.
+func checkDatasets(ctx context.Context, versions map[string]int64) {
+	cfg := tldRegistry.Config()
+	for _, name := range cfg.Names() {
+		tld := cfg.TLDs[name]
+		for _, ds := range []struct {
+			name string
+			db   *config.Database
+		}{{cache.DatasetDump, tld.Dump}, {cache.DatasetDiff, tld.Diff}} {
+			if ds.db == nil {
+				continue
+			}
+			tag := cache.DatasetTag(name, ds.name)
+			version, err := datasetVersion(ctx, *ds.db)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("dataset version check failed", slog.String("tag", tag), logging.Err(err))
+				}
+				continue
+			}
+			seen, ok := versions[tag]
+			if ok && seen == version {
+				continue
+			}
+			if ok {
+				// A failed invalidation keeps the old version so the next check retries it.
+				if err := responseCache.Invalidate(ctx, tag); err != nil {
+					slog.Warn("cache invalidation failed", slog.String("tag", tag), logging.Err(err))
+					continue
+				}
+				slog.Info("invalidated cached responses after new data", slog.String("tag", tag), slog.Int64("version", version))
+			}
+			versions[tag] = version
+		}
+	}
+}
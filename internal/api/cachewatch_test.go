@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"testing"
+)
+
+func TestCheckDatasetsInvalidatesNewData(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Dump: &config.Database{Name: "sedump"}, Diff: &config.Database{Name: "sediff"}, Endpoints: []string{config.EndpointStats}},
+	}}))
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+	versions := map[string]int64{"sedump": 7, "sediff": 3}
+	swap(t, &datasetVersion, func(_ context.Context, db config.Database) (int64, error) {
+		return versions[db.Name], nil
+	})
+
+	fill := func() {
+		mem.Set(ctx, "stats:se", []byte("[]"), 0, cache.Tags("se", cache.DatasetDump)...)
+		mem.Set(ctx, "sedates:page:0", []byte("[]"), 0, cache.Tags("se", cache.DatasetDiff)...)
+	}
+	seen := make(map[string]int64)
+
+	// The first check records the versions without dropping anything.
+	fill()
+	checkDatasets(ctx, seen)
+	if mem.Len() != 2 {
+		t.Fatalf("first check left %d entries, want 2", mem.Len())
+	}
+	checkDatasets(ctx, seen)
+	if mem.Len() != 2 {
+		t.Fatalf("unchanged data left %d entries, want 2", mem.Len())
+	}
+
+	// A new dump day drops the dump responses only.
+	versions["sedump"] = 8
+	checkDatasets(ctx, seen)
+	if _, err := mem.Get(ctx, "stats:se"); err == nil || mem.Len() != 1 {
+		t.Errorf("new dump data left %d entries, want the diff entry only", mem.Len())
+	}
+
+	fill()
+	versions["sediff"] = 4
+	checkDatasets(ctx, seen)
+	if _, err := mem.Get(ctx, "sedates:page:0"); err == nil || mem.Len() != 1 {
+		t.Errorf("new diff data left %d entries, want the dump entry only", mem.Len())
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings negotiated through Accept-Encoding. Identity, no compression, is "".
+const (
+	codingGzip   = "gzip"
+	codingBrotli = "br"
+	codingZstd   = "zstd"
+)
+
+// responseCodings lists the supported codings in order of preference among equally accepted ones.
+var responseCodings = []string{codingBrotli, codingZstd, codingGzip}
+
+// acceptedCodings parses Accept-Encoding into the quality of each listed coding, lower-cased.
+func acceptedCodings(r *http.Request) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, field := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(field, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+			accepted[name] = q
+		}
+	}
+	return accepted
+}
+
+// codingQuality is the quality a client gives coding, falling back to its "*" entry.
+func codingQuality(accepted map[string]float64, coding string) float64 {
+	if q, ok := accepted[coding]; ok {
+		return q
+	}
+	return accepted["*"]
+}
+
+// negotiateEncoding picks the response coding the client prefers, or "" to send the response
+// uncompressed.
+func negotiateEncoding(r *http.Request) string {
+	accepted := acceptedCodings(r)
+	best, bestQ := "", 0.0
+	for _, coding := range responseCodings {
+		if q := codingQuality(accepted, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// newCompressor returns a writer compressing to w with coding at level, or nil for identity.
+// Closing it writes the end of the stream.
+func newCompressor(w io.Writer, coding string, level int) (io.WriteCloser, error) {
+	switch coding {
+	case codingGzip:
+		return gzip.NewWriterLevel(w, level)
+	case codingBrotli:
+		return brotli.NewWriterLevel(w, level), nil
+	case codingZstd:
+		// A single goroutine-free encoder, as aborted exports never close theirs.
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevel(level)), zstd.WithEncoderConcurrency(1))
+	}
+	return nil, nil
+}
+
+// defaultLevel is the default compression level of coding.
+func defaultLevel(coding string) int {
+	switch coding {
+	case codingBrotli:
+		return brotli.DefaultCompression
+	case codingZstd:
+		return int(zstd.SpeedDefault)
+	}
+	return gzip.DefaultCompression
+}
+
+// compress returns data compressed with coding at its default level.
+func compress(data []byte, coding string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := newCompressor(&buf, coding, defaultLevel(coding))
+	if err != nil || zw == nil {
+		return data, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// refreshedValue returns the value the background refresh of the stale key produced, without running
+// its generator again: the refresh still in flight is joined, or the value it stored is read back.
+// When the refresh failed the stale value is kept.
+func refreshedValue(ctx context.Context, key string, stale []byte) ([]byte, error) {
+	data, inFlight, err := cacheFlights.wait(ctx, key)
+	if inFlight {
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return stale, nil
+	}
+	raw, err := responseCache.Get(ctx, key)
+	if err != nil {
+		return stale, nil
+	}
+	if entry, ok := decodeCacheEntry(raw); ok && entry.fresh(time.Now()) {
+		return entry.Data, nil
+	}
+	return stale, nil
+}
+
+// setEncodingHeaders marks a response compressed with coding; identity responses still vary on
+// Accept-Encoding.
+func setEncodingHeaders(w http.ResponseWriter, coding string) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if coding != "" {
+		w.Header().Set("Content-Encoding", coding)
+	}
+}
+
+// getOrSetCompressed is getOrSetCache for a response sent with coding. The plain response is
+// generated once and cached under key; each coding caches a copy compressed from it under its own
+// key, so hits are written as they are.
+func getOrSetCompressed(ctx context.Context, key string, coding string, ttl time.Duration, tags []string, generator func(context.Context) ([]byte, error)) ([]byte, string, error) {
+	if coding == "" {
+		return getOrSetCache(ctx, key, ttl, tags, generator)
+	}
+	return getOrSetCache(ctx, key+":"+coding, ttl, tags, func(ctx context.Context) ([]byte, error) {
+		data, status, err := getOrSetCache(ctx, key, ttl, tags, generator)
+		if err == nil && status == cacheStale {
+			// A copy of the stale response would be kept for another TTL; take the refreshed one.
+			data, err = refreshedValue(ctx, key, data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := compress(data, coding)
+		if err != nil {
+			return nil, errEncode(err)
+		}
+		return compressed, nil
+	})
+}
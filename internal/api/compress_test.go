@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"go-axfr-backend/internal/cache"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"gzip":                  codingGzip,
+		"deflate, GZIP;q=0.5":   codingGzip,
+		"br, gzip; q=0":         codingBrotli,
+		"gzip;q=0.0, *":         codingBrotli,
+		"gzip;q=0, *;q=0":       "",
+		"x-gzip":                "",
+		"gzip, deflate, br":     codingBrotli,
+		"gzip;q=1, br;q=0.8":    codingGzip,
+		"zstd, gzip":            codingZstd,
+		"identity":              "",
+		"gzip;q=abc, zstd;q=.1": codingZstd,
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", header)
+		if got := negotiateEncoding(r); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func decompress(t *testing.T, coding string, data []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch coding {
+	case codingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case codingBrotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case codingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return string(data)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompressing %s: %v", coding, err)
+	}
+	return string(plain)
+}
+
+func TestServeCachedCompressed(t *testing.T) {
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+
+	rows := make([]domainRow, 200)
+	for i := range rows {
+		rows[i] = domainRow{Domain: "example.se"}
+	}
+	plain := `[` + strings.TrimSuffix(strings.Repeat(`{"domain":"example.se"},`, 200), ",") + `]`
+	var generated atomic.Int32
+
+	for _, coding := range []string{codingGzip, codingBrotli, codingZstd, ""} {
+		for i, wantCache := range []string{cacheMiss, cacheHit} {
+			// The plain response was cached by the first compressed miss.
+			if coding == "" && i == 0 {
+				wantCache = cacheHit
+			}
+			req := httptest.NewRequest(http.MethodGet, "/search/se/example", nil)
+			req.Header.Set("Accept-Encoding", coding)
+			rr := httptest.NewRecorder()
+			serveCached(rr, req, "search:se:example", ShortTTL, cache.Tags("se", cache.DatasetDump), func(context.Context) ([]domainRow, error) {
+				generated.Add(1)
+				return rows, nil
+			})
+
+			h := rr.Header()
+			if h.Get("Content-Encoding") != coding || h.Get("X-Cache") != wantCache || !strings.Contains(strings.Join(h.Values("Vary"), ","), "Accept-Encoding") {
+				t.Fatalf("%q: Content-Encoding %q, X-Cache %q, Vary %q", coding, h.Get("Content-Encoding"), h.Get("X-Cache"), h.Values("Vary"))
+			}
+			if got := decompress(t, coding, rr.Body.Bytes()); got != plain {
+				t.Errorf("%q: body = %q, want the JSON rows", coding, got)
+			}
+			if coding != "" && rr.Body.Len() >= len(plain) {
+				t.Errorf("%q: %d bytes for %d uncompressed", coding, rr.Body.Len(), len(plain))
+			}
+		}
+	}
+
+	// Every coding is compressed from the one cached plain response.
+	if generated.Load() != 1 {
+		t.Errorf("generator ran %d times for 4 codings, want 1", generated.Load())
+	}
+
+	// Hits are stored compressed and served without recompressing.
+	raw, err := mem.Get(context.Background(), "search:se:example:json:br")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := decodeCacheEntry(raw); !ok || decompress(t, codingBrotli, entry.Data) != plain {
+		t.Error("br entry is not the compressed response")
+	}
+}
+
+func TestCompressedRefreshWaitsForPlainRefresh(t *testing.T) {
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+
+	// Both the plain response and its gzip copy are past their soft TTL.
+	old, err := compress([]byte("old"), codingGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * time.Minute)
+	mem.Set(context.Background(), "k", cacheEntry{GeneratedAt: stale, SoftTTL: time.Minute, Data: []byte("old")}.encode(), 0)
+	mem.Set(context.Background(), "k:gzip", cacheEntry{GeneratedAt: stale, SoftTTL: time.Minute, Data: old}.encode(), 0)
+
+	data, status, err := getOrSetCompressed(context.Background(), "k", codingGzip, time.Minute, nil, func(context.Context) ([]byte, error) {
+		return []byte("new"), nil
+	})
+	if err != nil || status != cacheStale || decompress(t, codingGzip, data) != "old" {
+		t.Fatalf("getOrSetCompressed() = %q, %v, want the stale copy", status, err)
+	}
+
+	// The background refresh compresses the regenerated response, not the stale plain one.
+	deadline := time.Now().Add(time.Second)
+	for {
+		raw, err := mem.Get(context.Background(), "k:gzip")
+		if entry, ok := decodeCacheEntry(raw); err == nil && ok && decompress(t, codingGzip, entry.Data) == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("gzip copy was not refreshed from the new response")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStaleCompressedRefreshRunsGeneratorOnce(t *testing.T) {
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+
+	// The plain response and two compressed copies are past their soft TTL.
+	stale := time.Now().Add(-2 * time.Minute)
+	mem.Set(context.Background(), "k", cacheEntry{GeneratedAt: stale, SoftTTL: time.Minute, Data: []byte("old")}.encode(), 0)
+	for _, coding := range []string{codingGzip, codingBrotli} {
+		old, err := compress([]byte("old"), coding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mem.Set(context.Background(), "k:"+coding, cacheEntry{GeneratedAt: stale, SoftTTL: time.Minute, Data: old}.encode(), 0)
+	}
+
+	var generated atomic.Int32
+	generator := func(context.Context) ([]byte, error) {
+		generated.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return []byte("new"), nil
+	}
+	for _, coding := range []string{codingGzip, codingBrotli} {
+		if _, status, err := getOrSetCompressed(context.Background(), "k", coding, time.Minute, nil, generator); err != nil || status != cacheStale {
+			t.Fatalf("%s: getOrSetCompressed() = %q, %v, want the stale copy", coding, status, err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for _, coding := range []string{codingGzip, codingBrotli} {
+		for {
+			raw, err := mem.Get(context.Background(), "k:"+coding)
+			if entry, ok := decodeCacheEntry(raw); err == nil && ok && decompress(t, coding, entry.Data) == "new" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s copy was not refreshed from the new response", coding)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if got := generated.Load(); got != 1 {
+		t.Errorf("generator ran %d times for one stale refresh with two codings, want 1", got)
+	}
+
+	// A refresh that finished before the copy's refresh looked for it is read back from the cache.
+	mem.Set(context.Background(), "k", cacheEntry{GeneratedAt: time.Now(), SoftTTL: time.Minute, Data: []byte("newer")}.encode(), 0)
+	if data, err := refreshedValue(context.Background(), "k", []byte("old")); err != nil || string(data) != "newer" {
+		t.Errorf("refreshedValue() after the refresh = %q, %v, want the stored value", data, err)
+	}
+}
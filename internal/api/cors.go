@@ -0,0 +1,131 @@
+package api
+
+import (
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsPolicy answers cross-origin requests as configured in the registry's cors block.
+type corsPolicy struct {
+	origins     []string
+	credentials bool
+	methods     []string
+	headers     []string
+	anyHeader   bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+func newCORSPolicy(cfg config.CORS) *corsPolicy {
+	p := &corsPolicy{
+		origins:       cfg.AllowedOrigins,
+		credentials:   cfg.AllowCredentials,
+		methods:       cfg.AllowedMethods,
+		anyHeader:     slices.Contains(cfg.AllowedHeaders, "*"),
+		allowMethods:  strings.Join(cfg.AllowedMethods, ", "),
+		allowHeaders:  strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:        strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, h := range cfg.AllowedHeaders {
+		p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+	}
+	return p
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" when it is not allowed.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.origins {
+		if allowed == "*" {
+			return "*"
+		}
+		if allowed == origin {
+			return origin
+		}
+		// https://*.example matches https://app.example but not https://example itself.
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// allowHeadersFor returns the Access-Control-Allow-Headers value for a preflight's requested
+// headers, and false when one of them is not allowed.
+func (p *corsPolicy) allowHeadersFor(requested string) (string, bool) {
+	if p.anyHeader {
+		return requested, true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h != "" && !slices.Contains(p.headers, http.CanonicalHeaderKey(h)) {
+			return "", false
+		}
+	}
+	return p.allowHeaders, true
+}
+
+// CORS adds CORS headers to the responses of mux and answers preflight requests for its routes,
+// ahead of authentication and rate limiting. Preflights for paths mux does not serve fall through
+// to its 404, and disallowed preflights are answered without CORS headers so the browser blocks
+// the request. Without allowed origins mux is returned unchanged.
+func CORS(cfg config.CORS, mux *http.ServeMux) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return mux
+	}
+	p := newCORSPolicy(cfg)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		allowed := p.allowOrigin(origin)
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && requestMethod != "" {
+			if _, pattern := mux.Handler(r); pattern == "" {
+				mux.ServeHTTP(w, r)
+				return
+			}
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			allowHeaders, headersOK := p.allowHeadersFor(r.Header.Get("Access-Control-Request-Headers"))
+			if allowed != "" && headersOK && slices.Contains(p.methods, requestMethod) {
+				p.setOrigin(h, allowed)
+				h.Set("Access-Control-Allow-Methods", p.allowMethods)
+				if allowHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", allowHeaders)
+				}
+				h.Set("Access-Control-Max-Age", p.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed != "" {
+			p.setOrigin(h, allowed)
+			if p.exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
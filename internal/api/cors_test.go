@@ -0,0 +1,94 @@
+package api
+
+import (
+	"go-axfr-backend/internal/auth"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cors := config.DefaultCORS
+	cors.AllowedOrigins = []string{"https://app.example", "https://*.partner.example"}
+	cors.AllowCredentials = true
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{CORS: cors}))
+	// Preflights are answered before authentication, even when keys are required.
+	swap(t, &authenticator, &auth.Authenticator{Required: true})
+	routes := SetupRoutes()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+	}{
+		{"preflight", http.MethodOptions, "/search/se/example", "https://app.example", "GET", "x-api-key", http.StatusNoContent, "https://app.example", "GET, HEAD, POST"},
+		{"preflight POST", http.MethodOptions, "/search/se/example", "https://app.example", "POST", "", http.StatusNoContent, "https://app.example", "GET, HEAD, POST"},
+		{"wildcard subdomain", http.MethodOptions, "/dates/se", "https://eu.partner.example", "GET", "", http.StatusNoContent, "https://eu.partner.example", "GET, HEAD, POST"},
+		{"wildcard needs a subdomain", http.MethodOptions, "/dates/se", "https://partner.example", "GET", "", http.StatusNoContent, "", ""},
+		{"unknown origin", http.MethodOptions, "/dates/se", "https://evil.example", "GET", "", http.StatusNoContent, "", ""},
+		{"method not allowed", http.MethodOptions, "/dates/se", "https://app.example", "DELETE", "", http.StatusNoContent, "", ""},
+		{"header not allowed", http.MethodOptions, "/dates/se", "https://app.example", "GET", "X-Debug", http.StatusNoContent, "", ""},
+		{"unregistered path", http.MethodOptions, "/nope", "https://app.example", "GET", "", http.StatusNotFound, "", ""},
+		{"simple request", http.MethodGet, "/dates/se", "https://app.example", "", "", http.StatusUnauthorized, "https://app.example", ""},
+		{"same origin", http.MethodGet, "/dates/se", "", "", "", http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, req)
+
+			h := rr.Header()
+			if rr.Code != tt.wantStatus || h.Get("Access-Control-Allow-Origin") != tt.wantOrigin || h.Get("Access-Control-Allow-Methods") != tt.wantMethods {
+				t.Fatalf("got %d, origin %q, methods %q", rr.Code, h.Get("Access-Control-Allow-Origin"), h.Get("Access-Control-Allow-Methods"))
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			if h.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("allowed origin without Access-Control-Allow-Credentials")
+			}
+			if tt.reqMethod != "" && h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("preflight max age = %q, want 600", h.Get("Access-Control-Max-Age"))
+			}
+			if tt.reqMethod == "" && h.Get("Access-Control-Expose-Headers") == "" {
+				t.Error("response without Access-Control-Expose-Headers")
+			}
+		})
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	mux := http.NewServeMux()
+	if got := CORS(config.CORS{MaxAge: time.Minute}, mux); got != mux {
+		t.Errorf("CORS() without origins = %T, want the mux unchanged", got)
+	}
+
+	anyOrigin := config.DefaultCORS
+	anyOrigin.AllowedOrigins = []string{"*"}
+	mux.HandleFunc("/dates/", func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodGet, "/dates/se", nil)
+	req.Header.Set("Origin", "https://anyone.example")
+	rr := httptest.NewRecorder()
+	CORS(anyOrigin, mux).ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
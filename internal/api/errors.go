@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// apiError is an error carried up from the query layer with the HTTP status and machine-readable
+// code it is reported with. The cause is logged but never sent to clients.
+type apiError struct {
+	status  int
+	code    string
+	message string
+	cause   error
+	// retryAt, when set, is sent as Retry-After.
+	retryAt time.Time
+}
+
+func (e *apiError) Error() string {
+	if e.cause != nil {
+		return e.message + ": " + e.cause.Error()
+	}
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.cause
+}
+
+func badRequest(code string, message string) error {
+	return &apiError{status: http.StatusBadRequest, code: code, message: message}
+}
+
+func notFound(code string, message string) error {
+	return &apiError{status: http.StatusNotFound, code: code, message: message}
+}
+
+func methodNotAllowed(allowed string) error {
+	return &apiError{status: http.StatusMethodNotAllowed, code: "method_not_allowed", message: "method not allowed, use " + allowed}
+}
+
+func internalError(code string, message string, cause error) error {
+	return &apiError{status: http.StatusInternalServerError, code: code, message: message, cause: cause}
+}
+
+// errDatabase reports a database that could not be reached.
+func errDatabase(cause error) error {
+	return &apiError{status: http.StatusServiceUnavailable, code: "database_unavailable", message: "database connection failed", cause: cause}
+}
+
+// errQuery reports a failed query or row iteration.
+func errQuery(cause error) error {
+	return internalError("query_failed", "query failed", cause)
+}
+
+// errEncode reports a response that could not be marshalled.
+func errEncode(cause error) error {
+	return internalError("encoding_failed", "response encoding failed", cause)
+}
+
+// statusClientClosedRequest is recorded for requests whose client went away before the response,
+// following nginx. It is never seen by the client.
+const statusClientClosedRequest = 499
+
+// asAPIError returns the *apiError err is reported as. A canceled or timed out context takes
+// precedence over the error wrapping it, and other untyped errors are an opaque 500.
+func asAPIError(err error) *apiError {
+	var ae *apiError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &apiError{status: statusClientClosedRequest, code: "client_closed_request", message: "request canceled", cause: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &apiError{status: http.StatusGatewayTimeout, code: "timeout", message: "request timed out", cause: err}
+	case errors.As(err, &ae):
+		return ae
+	}
+	return &apiError{status: http.StatusInternalServerError, code: "internal_error", message: "internal server error", cause: err}
+}
+
+// errorStatus returns the HTTP status err is reported with.
+func errorStatus(err error) int {
+	return asAPIError(err).status
+}
+
+// retryAfter formats the Retry-After seconds until t, at least one.
+func retryAfter(t time.Time) string {
+	return strconv.Itoa(max(1, int(math.Ceil(time.Until(t).Seconds()))))
+}
+
+// writeError writes err as {"error": {"code", "message", "request_id"}}, see asAPIError. A request
+// canceled by its client only gets statusClientClosedRequest recorded, without a body.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	ae := asAPIError(err)
+	if ae.status == statusClientClosedRequest {
+		slog.DebugContext(r.Context(), "request canceled by client", slog.String("method", r.Method), slog.String("path", r.URL.Path), logging.Err(err))
+		w.WriteHeader(ae.status)
+		return
+	}
+	if ae.status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("code", ae.code), logging.Err(err))
+	}
+
+	type Body struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	j, _ := json.Marshal(struct {
+		Error Body `json:"error"`
+	}{Body{Code: ae.code, Message: ae.message, RequestID: requestID(r)}})
+
+	w.Header().Set("content-type", "application/json")
+	if ae.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="axfr"`)
+	}
+	if !ae.retryAt.IsZero() {
+		w.Header().Set("Retry-After", retryAfter(ae.retryAt))
+	}
+	w.WriteHeader(ae.status)
+	w.Write(j)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{name: "bad request", err: badRequest("invalid_page", "invalid page number"), wantStatus: http.StatusBadRequest, wantCode: "invalid_page", wantMsg: "invalid page number"},
+		{name: "database", err: errDatabase(errors.New("dial tcp: refused")), wantStatus: http.StatusServiceUnavailable, wantCode: "database_unavailable", wantMsg: "database connection failed"},
+		{name: "query", err: errQuery(errors.New("syntax error")), wantStatus: http.StatusInternalServerError, wantCode: "query_failed", wantMsg: "query failed"},
+		{name: "untyped", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error", wantMsg: "internal server error"},
+		{name: "query timed out", err: errQuery(context.DeadlineExceeded), wantStatus: http.StatusGatewayTimeout, wantCode: "timeout", wantMsg: "request timed out"},
+		{name: "client gone", err: errQuery(context.Canceled), wantStatus: statusClientClosedRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, r, tt.err)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(requestIDHeader, "req-123")
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantCode == "" {
+				if rr.Body.Len() != 0 {
+					t.Errorf("body = %q, want none for a canceled request", rr.Body.String())
+				}
+				return
+			}
+			var body struct {
+				Error struct {
+					Code      string `json:"code"`
+					Message   string `json:"message"`
+					RequestID string `json:"request_id"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rr.Body.String(), err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message != tt.wantMsg || body.Error.RequestID != "req-123" {
+				t.Errorf("error = %+v, want code %q, message %q and the request ID", body.Error, tt.wantCode, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestServeCachedDoesNotWriteErrorsAsData(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/stats/se", nil)
+	serveCached(rr, req, "stats:se", ShortTTL, cache.Tags("se", cache.DatasetDump), func(context.Context) ([]int, error) {
+		return nil, errDatabase(errors.New("refused"))
+	})
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if rr.Header().Get("X-Cache") != "" {
+		t.Errorf("X-Cache = %q, want unset on errors", rr.Header().Get("X-Cache"))
+	}
+}
+
+func TestLookupErrorStatus(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Dump: &config.Database{Name: "sedump"}, Endpoints: []string{config.EndpointSearch}},
+	}}))
+
+	if _, err := getDumpDatabase("xx", config.EndpointSearch); errorStatus(err) != http.StatusNotFound {
+		t.Errorf("unknown TLD status = %d, want 404", errorStatus(err))
+	}
+	if _, err := getDiffDatabase("se", config.EndpointDates); errorStatus(err) != http.StatusNotFound {
+		t.Errorf("disabled endpoint status = %d, want 404", errorStatus(err))
+	}
+	if _, err := getPathParams("/search", 3); errorStatus(err) != http.StatusBadRequest {
+		t.Errorf("invalid path status = %d, want 400", errorStatus(err))
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// exportFlushRows is how many rows are buffered between flushes to the client.
+	exportFlushRows = 5000
+	// exportStallTimeout replaces the server's write timeout for exports, which outlast it: each
+	// flush must complete within it.
+	exportStallTimeout = time.Minute
+)
+
+// exportContentTypes maps the file extensions served by /export to their content types.
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"txt":    "text/plain; charset=utf-8",
+}
+
+// exportEncoder writes exported domains in one of the export formats.
+type exportEncoder interface {
+	encode(domain string) error
+	// flush writes buffered rows through to the underlying writer.
+	flush() error
+}
+
+func newExportEncoder(format string, w io.Writer) exportEncoder {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"domain"})
+		return csvEncoder{cw}
+	case "ndjson":
+		bw := bufio.NewWriter(w)
+		return ndjsonEncoder{bw, json.NewEncoder(bw)}
+	default:
+		return textEncoder{bufio.NewWriter(w)}
+	}
+}
+
+type csvEncoder struct{ w *csv.Writer }
+
+func (e csvEncoder) encode(domain string) error {
+	return e.w.Write([]string{domain})
+}
+
+func (e csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e ndjsonEncoder) encode(domain string) error {
+	return e.enc.Encode(struct {
+		Domain string `json:"domain"`
+	}{domain})
+}
+
+func (e ndjsonEncoder) flush() error {
+	return e.w.Flush()
+}
+
+type textEncoder struct{ w *bufio.Writer }
+
+func (e textEncoder) encode(domain string) error {
+	e.w.WriteString(domain)
+	return e.w.WriteByte('\n')
+}
+
+func (e textEncoder) flush() error {
+	return e.w.Flush()
+}
+
+// parseExportPath splits /export/{tld}/{date}.{format}.
+func parseExportPath(path string) (tld string, date int, format string, err error) {
+	parts, err := getPathParams(path, 3)
+	if err != nil {
+		return "", 0, "", err
+	}
+	dateParam, format, _ := strings.Cut(parts[2], ".")
+	if _, ok := exportContentTypes[format]; !ok {
+		return "", 0, "", badRequest("invalid_format", "export format must be csv, ndjson or txt")
+	}
+	date, err = strconv.Atoi(dateParam)
+	if err != nil {
+		return "", 0, "", badRequest("invalid_date", "invalid date number")
+	}
+	return parts[1], date, format, nil
+}
+
+// exportDay streams every domain added on a day, /export/{tld}/{date}.{csv|ndjson|txt}, straight
+// from the rows cursor. X-Total-Count lets clients check that they received every row: once rows
+// are streaming a failure can no longer be reported, so the connection is aborted instead.
+func exportDay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tld, date, format, err := parseExportPath(r.URL.Path)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	diffdb, err := getDiffDatabase(tld, config.EndpointExport)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	db, err := dbConn(ctx, diffdb)
+	if err != nil {
+		writeError(w, r, errDatabase(err))
+		return
+	}
+
+	start := time.Now()
+	var dategrp, total int
+	err = database.QueryRow(ctx, db, "SELECT id FROM dates WHERE date = ?", date).Scan(&dategrp)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("unknown_date", fmt.Sprintf("no data for date: %d", date)))
+		return
+	}
+	if err == nil {
+		err = database.QueryRow(ctx, db, "SELECT COUNT(*) FROM "+addedTable+" WHERE dategrp = ?", dategrp).Scan(&total)
+	}
+	if err != nil {
+		writeError(w, r, errQuery(err))
+		return
+	}
+	observeQuery(ctx, "export_count", fmt.Sprintf("%s %d", tld, date), start)
+
+	rows, err := database.Query(ctx, db, "SELECT domain FROM "+addedTable+" WHERE dategrp = ? ORDER BY domain ASC", dategrp)
+	if err != nil {
+		writeError(w, r, errQuery(err))
+		return
+	}
+	defer rows.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", exportContentTypes[format])
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.%s"`, tld, date, format))
+	h.Set("X-Total-Count", strconv.Itoa(total))
+	h.Set("X-Source-Date", strconv.Itoa(date))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("export.format", format), attribute.Int("export.total", total))
+	streamDomains(w, r, rows, func(out io.Writer) exportEncoder {
+		return newExportEncoder(format, out)
+	})
+}
+
+// streamDomains writes the domains of rows through the encoder newEncoder returns, compressed in the
+// coding the client prefers, flushing every exportFlushRows rows. The caller sets the other headers first.
+// A failure once rows are streaming aborts the connection.
+func streamDomains(w http.ResponseWriter, r *http.Request, rows *database.Rows, newEncoder func(out io.Writer) exportEncoder) {
+	coding := negotiateEncoding(r)
+	var out io.Writer = w
+	zw, err := newCompressor(w, coding, defaultLevel(coding))
+	if err != nil {
+		writeError(w, r, errEncode(err))
+		return
+	}
+	setEncodingHeaders(w, coding)
+	if zw != nil {
+		out = zw
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportStallTimeout))
+	enc := newEncoder(out)
+	sent := 0
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			abortExport(r, sent, err)
+		}
+		if err := enc.encode(domain); err != nil {
+			abortExport(r, sent, err)
+		}
+		sent++
+		if sent%exportFlushRows == 0 {
+			if err := flushExport(enc, zw, rc); err != nil {
+				abortExport(r, sent, err)
+			}
+			rc.SetWriteDeadline(time.Now().Add(exportStallTimeout))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(r, sent, err)
+	}
+	if err := enc.flush(); err != nil {
+		abortExport(r, sent, err)
+	}
+	// The end of the compressed stream is only written here: an aborted export must not end in a valid one.
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			abortExport(r, sent, err)
+		}
+	}
+}
+
+// flushExport pushes the rows buffered in enc through the compressor, if any, and the connection,
+// so the client receives them before the write deadline is extended.
+func flushExport(enc exportEncoder, zw io.Writer, rc *http.ResponseController) error {
+	if err := enc.flush(); err != nil {
+		return err
+	}
+	if f, ok := zw.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return rc.Flush()
+}
+
+// abortExport logs a failed export and drops the connection, so the client sees a truncated
+// response rather than a short but complete one.
+func abortExport(r *http.Request, sent int, err error) {
+	failSpan(trace.SpanFromContext(r.Context()), err)
+	slog.ErrorContext(r.Context(), "export aborted", slog.String("path", r.URL.Path), slog.Int("sent", sent), logging.Err(err))
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/metrics"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseExportPath(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantTLD    string
+		wantDate   int
+		wantFormat string
+		wantCode   string
+	}{
+		{path: "/export/se/20250314.csv", wantTLD: "se", wantDate: 20250314, wantFormat: "csv"},
+		{path: "/export/nu/20250314.ndjson", wantTLD: "nu", wantDate: 20250314, wantFormat: "ndjson"},
+		{path: "/export/se/20250314.txt", wantTLD: "se", wantDate: 20250314, wantFormat: "txt"},
+		{path: "/export/se/20250314.xml", wantCode: "invalid_format"},
+		{path: "/export/se/20250314", wantCode: "invalid_format"},
+		{path: "/export/se/today.csv", wantCode: "invalid_date"},
+		{path: "/export/se", wantCode: "invalid_path"},
+	}
+	for _, tt := range tests {
+		tld, date, format, err := parseExportPath(tt.path)
+		if tt.wantCode != "" {
+			if code := errorCode(err); code != tt.wantCode {
+				t.Errorf("parseExportPath(%q) error code = %q, want %q", tt.path, code, tt.wantCode)
+			}
+			continue
+		}
+		if err != nil || tld != tt.wantTLD || date != tt.wantDate || format != tt.wantFormat {
+			t.Errorf("parseExportPath(%q) = %q, %d, %q, %v", tt.path, tld, date, format, err)
+		}
+	}
+}
+
+func errorCode(err error) string {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.code
+	}
+	return ""
+}
+
+func TestExportEncoders(t *testing.T) {
+	tests := map[string]string{
+		"csv":    "domain\na.se\nb.se\n",
+		"ndjson": "{\"domain\":\"a.se\"}\n{\"domain\":\"b.se\"}\n",
+		"txt":    "a.se\nb.se\n",
+	}
+	for format, want := range tests {
+		var buf bytes.Buffer
+		enc := newExportEncoder(format, &buf)
+		enc.encode("a.se")
+		enc.encode("b.se")
+		if err := enc.flush(); err != nil || buf.String() != want {
+			t.Errorf("%s export = %q, %v, want %q", format, buf.String(), err, want)
+		}
+	}
+}
+
+func TestFlushExportReachesClient(t *testing.T) {
+	rr := httptest.NewRecorder()
+	zw, err := newCompressor(rr, codingGzip, defaultLevel(codingGzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := newExportEncoder("txt", zw)
+	enc.encode("a.se")
+	enc.encode("b.se")
+	if err := flushExport(enc, zw, http.NewResponseController(rr)); err != nil {
+		t.Fatalf("flushExport() error = %v", err)
+	}
+	if !rr.Flushed {
+		t.Error("flushExport() did not flush the response")
+	}
+
+	// The rows can be decompressed before the stream is closed.
+	zr, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len("a.se\nb.se\n"))
+	if _, err := io.ReadFull(zr, got); err != nil || string(got) != "a.se\nb.se\n" {
+		t.Errorf("flushed rows = %q, %v", got, err)
+	}
+}
+
+func TestExportDayErrors(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Diff: &config.Database{Name: "sediff"}, Endpoints: []string{config.EndpointDates}},
+	}}))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/export/se/20250314.xml", http.StatusBadRequest},
+		{"/export/xx/20250314.csv", http.StatusNotFound},
+		{"/export/se/20250314.csv", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		exportDay(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rr.Code != tt.wantStatus || rr.Header().Get("X-Total-Count") != "" {
+			t.Errorf("GET %s = %d, want %d without export headers", tt.path, rr.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestMiddlewareRecordsAbortedStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/abort-test/", Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	}))
+
+	counter := metrics.HTTPRequests.WithLabelValues("/abort-test/", http.MethodGet, "200")
+	before := testutil.ToFloat64(counter)
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler passed on to net/http", p)
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort-test/x", nil))
+	}()
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("aborted requests counted = %v, want 1", got)
+	}
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// feedEntries is the number of ingestion days a feed covers.
+	feedEntries = 20
+	// feedMaxDomains caps the matching domains listed in one entry; the count covers all of them.
+	feedMaxDomains = 100
+)
+
+// feedContentTypes maps the file extensions served by /feeds to their content types.
+var feedContentTypes = map[string]string{
+	"atom": "application/atom+xml; charset=utf-8",
+	"rss":  "application/rss+xml; charset=utf-8",
+}
+
+// feedDay is one ingestion day of a feed. Without a match filter Count is the day's new-domain
+// count from the dates table and Domains is empty; with one, both cover the matching domains only.
+// Days are cached as JSON, the feed documents are rendered per request.
+type feedDay struct {
+	ID      int      `json:"id"`
+	Date    int      `json:"date"`
+	Count   int      `json:"count"`
+	Domains []string `json:"domains,omitempty"`
+}
+
+// feedDays returns the latest feedEntries days of a diff database, newest first. With sq only the
+// days that added a matching domain are kept.
+func feedDays(ctx context.Context, diffdb config.Database, sq *searchQuery) ([]feedDay, error) {
+	defer observeQuery(ctx, "feed", diffdb.ID, time.Now())
+
+	db, err := dbConn(ctx, diffdb)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	rows, err := database.Query(ctx, db, "SELECT id, date, COALESCE(amount, 0) FROM dates ORDER BY date DESC LIMIT ?", feedEntries)
+	if err != nil {
+		return nil, errQuery(err)
+	}
+	defer rows.Close()
+
+	var days []feedDay
+	for rows.Next() {
+		var day feedDay
+		if err := rows.Scan(&day.ID, &day.Date, &day.Count); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+			continue
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errQuery(err)
+	}
+	if sq == nil || len(days) == 0 {
+		return days, nil
+	}
+
+	byID := make(map[int]*feedDay, len(days))
+	args := make([]interface{}, 0, len(days)+len(sq.args))
+	for i := range days {
+		days[i].Count = 0
+		byID[days[i].ID] = &days[i]
+		args = append(args, days[i].ID)
+	}
+	args = append(args, sq.args...)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(days)), ", ")
+	matches, err := database.Query(ctx, db, "SELECT dategrp, domain FROM "+addedTable+" WHERE dategrp IN ("+placeholders+") AND "+sq.cond+" ORDER BY dategrp, domain ASC", args...)
+	if err != nil {
+		return nil, errQuery(err)
+	}
+	defer matches.Close()
+
+	for matches.Next() {
+		var dategrp int
+		var domain string
+		if err := matches.Scan(&dategrp, &domain); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+			continue
+		}
+		day := byID[dategrp]
+		if day == nil || (sq.re != nil && !sq.re.MatchString(domain)) {
+			continue
+		}
+		day.Count++
+		if len(day.Domains) < feedMaxDomains {
+			day.Domains = append(day.Domains, domain)
+		}
+	}
+	if err := matches.Err(); err != nil {
+		return nil, errQuery(err)
+	}
+
+	matched := days[:0]
+	for _, day := range days {
+		if day.Count > 0 {
+			matched = append(matched, day)
+		}
+	}
+	return matched, nil
+}
+
+// feed is the rendering input shared by the Atom and RSS formats.
+type feed struct {
+	tld  string
+	name string
+	// self is the canonical URL of the feed, base the URL the entry links are built on.
+	self  string
+	base  string
+	match *searchQuery
+	days  []feedDay
+}
+
+func (f *feed) title() string {
+	if f.match != nil {
+		return fmt.Sprintf("New %s domains matching %q", f.name, f.match.term)
+	}
+	return "New " + f.name + " domains"
+}
+
+func (f *feed) entryTitle(day feedDay) string {
+	matching := ""
+	if f.match != nil {
+		matching = fmt.Sprintf(" matching %q", f.match.term)
+	}
+	return fmt.Sprintf("%d new .%s domains%s on %s", day.Count, f.tld, matching, dayTime(day.Date).Format(time.DateOnly))
+}
+
+// listURL links to the day's full list of new domains.
+func (f *feed) listURL(day feedDay) string {
+	return fmt.Sprintf("%s/domains/%s/%d", f.base, f.tld, day.Date)
+}
+
+func (f *feed) entryID(day feedDay) string {
+	return f.self + "#" + strconv.Itoa(day.Date)
+}
+
+// entryHTML lists the day's matching domains, if any, and links to the full list.
+func (f *feed) entryHTML(day feedDay) string {
+	var b strings.Builder
+	b.WriteString("<p>" + html.EscapeString(f.entryTitle(day)) + ".</p>")
+	if len(day.Domains) > 0 {
+		b.WriteString("<ul>")
+		for _, domain := range day.Domains {
+			b.WriteString("<li>" + html.EscapeString(domain) + "</li>")
+		}
+		b.WriteString("</ul>")
+		if more := day.Count - len(day.Domains); more > 0 {
+			fmt.Fprintf(&b, "<p>And %d more.</p>", more)
+		}
+	}
+	fmt.Fprintf(&b, `<p><a href="%s">All new domains of the day</a></p>`, html.EscapeString(f.listURL(day)))
+	return b.String()
+}
+
+// updated is the date of the newest entry, or the zero time for an empty feed.
+func (f *feed) updated() time.Time {
+	if len(f.days) == 0 {
+		return time.Time{}
+	}
+	return dayTime(f.days[0].Date)
+}
+
+// dayTime returns midnight UTC of a diff date such as 20250314.
+func dayTime(date int) time.Time {
+	t, _ := time.Parse("20060102", strconv.Itoa(date))
+	return t
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Content atomText `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f *feed) atom() ([]byte, error) {
+	doc := atomFeed{
+		ID:      f.self,
+		Title:   f.title(),
+		Updated: f.updated().Format(time.RFC3339),
+		Author:  atomAuthor{Name: f.name + " zone diff"},
+		Links:   []atomLink{{Rel: "self", Href: f.self}},
+	}
+	for _, day := range f.days {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:      f.entryID(day),
+			Title:   f.entryTitle(day),
+			Updated: dayTime(day.Date).Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Href: f.listURL(day)},
+			Content: atomText{Type: "html", Body: f.entryHTML(day)},
+		})
+	}
+	return marshalFeed(doc)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *feed) rss() ([]byte, error) {
+	doc := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       f.title(),
+		Link:        f.self,
+		Description: "Domains newly registered under ." + f.tld + ", one entry per ingestion day.",
+	}}
+	if len(f.days) > 0 {
+		doc.Channel.LastBuildDate = f.updated().Format(time.RFC1123Z)
+	}
+	for _, day := range f.days {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       f.entryTitle(day),
+			Link:        f.listURL(day),
+			GUID:        rssGUID{Value: f.entryID(day)},
+			PubDate:     dayTime(day.Date).Format(time.RFC1123Z),
+			Description: f.entryHTML(day),
+		})
+	}
+	return marshalFeed(doc)
+}
+
+func marshalFeed(doc any) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, errEncode(err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// publicBaseURL returns the configured public_url, or the scheme and host the request was sent to.
+func publicBaseURL(r *http.Request) string {
+	if base := tldRegistry.Config().PublicURL; base != "" {
+		return base
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// tldFeed serves the new domains of the latest ingestion days as /feeds/{tld}.atom or
+// /feeds/{tld}.rss. ?match= (with the search ?mode=) limits the entries to matching domains.
+func tldFeed(w http.ResponseWriter, r *http.Request) {
+	parts, err := getPathParams(r.URL.Path, 2)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tld, format, _ := strings.Cut(parts[1], ".")
+	contentType, ok := feedContentTypes[format]
+	if !ok {
+		writeError(w, r, badRequest("invalid_format", "feed format must be atom or rss"))
+		return
+	}
+	diffdb, err := getDiffDatabase(tld, config.EndpointFeeds)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	entry, _ := tldRegistry.Lookup(tld)
+
+	f := feed{tld: tld, name: entry.DisplayName, base: publicBaseURL(r)}
+	f.self = f.base + "/feeds/" + tld + "." + format
+	params := r.URL.Query()
+	if params.Has("match") {
+		sq, err := parseSearchQuery(params.Get("mode"), params.Get("match"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		f.match = &sq
+		f.self += "?" + url.Values{"match": {sq.term}, "mode": {sq.mode}}.Encode()
+	}
+
+	// Only the days are cached: the links are built on the request's base URL, which without
+	// public_url comes from the client's Host header, so the documents are rendered per request.
+	data, status, err := getOrSetCache(r.Context(), feedCacheKey(tld, f.match), MediumTTL, cache.Tags(tld, cache.DatasetDiff), func(ctx context.Context) ([]byte, error) {
+		days, err := feedDays(ctx, diffdb, f.match)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(days)
+		if err != nil {
+			return nil, errEncode(err)
+		}
+		return data, nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := json.Unmarshal(data, &f.days); err != nil {
+		writeError(w, r, errEncode(err))
+		return
+	}
+	render := f.atom
+	if format == "rss" {
+		render = f.rss
+	}
+	body, err := render()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	coding := negotiateEncoding(r)
+	zw, err := newCompressor(w, coding, defaultLevel(coding))
+	if err != nil {
+		writeError(w, r, errEncode(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	setEncodingHeaders(w, coding)
+	w.Header().Set("X-Cache", status)
+	if zw == nil {
+		w.Write(body)
+		return
+	}
+	zw.Write(body)
+	zw.Close()
+}
+
+// feedCacheKey identifies the days of a feed by TLD and match filter; both formats share them.
+func feedCacheKey(tld string, sq *searchQuery) string {
+	if sq == nil {
+		return "feed:" + tld
+	}
+	return "feed:" + tld + ":" + sq.mode + ":" + sq.term
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed(t *testing.T) *feed {
+	sq, err := parseSearchQuery("", "Bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &feed{
+		tld:   "se",
+		name:  "Sweden",
+		self:  "https://api.example/feeds/se.atom?match=bank&mode=contains",
+		base:  "https://api.example",
+		match: &sq,
+		days: []feedDay{
+			{Date: 20250314, Count: 3, Domains: []string{"bank<1>.se", "mybank.se"}},
+			{Date: 20250313, Count: 1, Domains: []string{"banken.se"}},
+		},
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	data, err := testFeed(t).atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc atomFeed
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("atom feed is not valid XML: %v\n%s", err, data)
+	}
+	if doc.Title != `New Sweden domains matching "bank"` || doc.Updated != "2025-03-14T00:00:00Z" || len(doc.Entries) != 2 {
+		t.Fatalf("feed = %q updated %q with %d entries", doc.Title, doc.Updated, len(doc.Entries))
+	}
+
+	entry := doc.Entries[0]
+	if entry.ID != "https://api.example/feeds/se.atom?match=bank&mode=contains#20250314" || entry.Link.Href != "https://api.example/domains/se/20250314" {
+		t.Errorf("entry id %q, link %q", entry.ID, entry.Link.Href)
+	}
+	if entry.Title != `3 new .se domains matching "bank" on 2025-03-14` {
+		t.Errorf("entry title = %q", entry.Title)
+	}
+	if !strings.Contains(entry.Content.Body, "<li>bank&lt;1&gt;.se</li>") || !strings.Contains(entry.Content.Body, "And 1 more.") {
+		t.Errorf("entry content = %q, want the escaped domains and the remainder", entry.Content.Body)
+	}
+}
+
+func TestFeedRSS(t *testing.T) {
+	f := testFeed(t)
+	f.match = nil
+	f.days = []feedDay{{Date: 20250314, Count: 44}}
+	data, err := f.rss()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc rssFeed
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("rss feed is not valid XML: %v\n%s", err, data)
+	}
+	if doc.Version != "2.0" || doc.Channel.Title != "New Sweden domains" || len(doc.Channel.Items) != 1 {
+		t.Fatalf("channel = %+v", doc.Channel)
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != "44 new .se domains on 2025-03-14" || item.PubDate != "Fri, 14 Mar 2025 00:00:00 +0000" || item.GUID.IsPermaLink {
+		t.Errorf("item = %+v", item)
+	}
+	if strings.Contains(item.Description, "<ul>") {
+		t.Errorf("description = %q, want no domain list without a match", item.Description)
+	}
+}
+
+func TestTLDFeedErrors(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Diff: &config.Database{Name: "sediff"}, Endpoints: []string{config.EndpointFeeds}},
+		"nu": {Diff: &config.Database{Name: "nudiff"}, Endpoints: []string{config.EndpointDates}},
+	}}))
+
+	tests := map[string]string{
+		"/feeds/se.json":                    "invalid_format",
+		"/feeds/se":                         "invalid_format",
+		"/feeds/xx.atom":                    "unknown_tld",
+		"/feeds/nu.rss":                     "endpoint_not_enabled",
+		"/feeds/se.atom?match=":             "invalid_query",
+		"/feeds/se.atom?match=a&mode=fuzzy": "invalid_mode",
+	}
+	for path, want := range tests {
+		rr := httptest.NewRecorder()
+		tldFeed(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code < 400 || !strings.Contains(rr.Body.String(), `"code":"`+want+`"`) {
+			t.Errorf("%s = %d %s, want %s", path, rr.Code, rr.Body.String(), want)
+		}
+	}
+}
+
+func TestPublicBaseURL(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{}))
+	req := httptest.NewRequest(http.MethodGet, "/feeds/se.atom", nil)
+	req.Host = "api.internal:8080"
+	if got := publicBaseURL(req); got != "http://api.internal:8080" {
+		t.Errorf("publicBaseURL() = %q, want the request host", got)
+	}
+
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{PublicURL: "https://api.example"}))
+	if got := publicBaseURL(req); got != "https://api.example" {
+		t.Errorf("publicBaseURL() = %q, want the configured public url", got)
+	}
+}
+
+func TestTLDFeedCachesDaysNotLinks(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {DisplayName: "Sweden", Diff: &config.Database{Name: "sediff"}, Endpoints: []string{config.EndpointFeeds}},
+	}}))
+	mem := cache.NewMemory(0, 0)
+	swap[cache.Cache](t, &responseCache, mem)
+
+	entry := cacheEntry{GeneratedAt: time.Now(), SoftTTL: MediumTTL, Data: []byte(`[{"id":7,"date":20250314,"count":44}]`)}
+	mem.Set(context.Background(), feedCacheKey("se", nil), entry.encode(), 0)
+
+	for _, host := range []string{"api.example", "forged.example"} {
+		for _, format := range []string{"atom", "rss"} {
+			req := httptest.NewRequest(http.MethodGet, "/feeds/se."+format, nil)
+			req.Host = host
+			req.Header.Set("Accept-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+			tldFeed(rr, req)
+
+			body := decompress(t, rr.Header().Get("Content-Encoding"), rr.Body.Bytes())
+			if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != cacheHit || rr.Header().Get("Content-Encoding") != codingGzip {
+				t.Fatalf("%s %s = %d, X-Cache %q, Content-Encoding %q", host, format, rr.Code, rr.Header().Get("X-Cache"), rr.Header().Get("Content-Encoding"))
+			}
+			if !strings.Contains(body, "http://"+host+"/domains/se/20250314") || !strings.Contains(body, "44 new .se domains") {
+				t.Errorf("%s %s feed = %s, want links to the request host", host, format, body)
+			}
+		}
+	}
+	// Every host and format was served from the one cached entry.
+	if mem.Len() != 1 {
+		t.Errorf("cache holds %d entries, want 1", mem.Len())
+	}
+}
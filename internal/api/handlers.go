@@ -3,18 +3,23 @@ package api
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/metrics"
 	"go-axfr-backend/internal/models"
+	"go-axfr-backend/internal/tracing"
 	"go-axfr-backend/pkg/health"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 /* Optimize queries for se-nu appearance
@@ -22,283 +27,234 @@ CREATE INDEX domain_idx ON domains(domain);
 CREATE INDEX dategrp_idx ON domains(dategrp);
 CREATE INDEX date_idx ON dates(date); */
 
-type TLDConfig struct {
-	Database string
-	Username string
-	Password string
-}
-
-var tldConfigs = map[string]TLDConfig{
-	"se": {
-		Database: "MYSQL_SEDUMP_DATABASE",
-		Username: "MYSQL_SEDUMP_USERNAME",
-		Password: "MYSQL_SEDUMP_PASSWORD",
-	},
-	"nu": {
-		Database: "MYSQL_NUDUMP_DATABASE",
-		Username: "MYSQL_NUDUMP_USERNAME",
-		Password: "MYSQL_NUDUMP_PASSWORD",
-	},
-	"ch": {
-		Database: "MYSQL_CHDUMP_DATABASE",
-		Username: "MYSQL_CHDUMP_USERNAME",
-		Password: "MYSQL_CHDUMP_PASSWORD",
-	},
-	"li": {
-		Database: "MYSQL_LIDUMP_DATABASE",
-		Username: "MYSQL_LIDUMP_USERNAME",
-		Password: "MYSQL_LIDUMP_PASSWORD",
-	},
-	"ee": {
-		Database: "MYSQL_EEDUMP_DATABASE",
-		Username: "MYSQL_EEDUMP_USERNAME",
-		Password: "MYSQL_EEDUMP_PASSWORD",
-	},
-	"sk": {
-		Database: "MYSQL_SKDUMP_DATABASE",
-		Username: "MYSQL_SKDUMP_USERNAME",
-		Password: "MYSQL_SKDUMP_PASSWORD",
-	},
-	"se_diff": {
-		Database: "MYSQL_SE_DATABASE",
-		Username: "MYSQL_SE_USERNAME",
-		Password: "MYSQL_SE_PASSWORD",
-	},
-	"nu_diff": {
-		Database: "MYSQL_NU_DATABASE",
-		Username: "MYSQL_NU_USERNAME",
-		Password: "MYSQL_NU_PASSWORD",
-	},
-}
-
 var (
-	redisClient *redis.Client
-	ctx         = context.Background()
+	responseCache cache.Cache = cache.Nop{}
+	tldRegistry   *config.Registry
+	dbPools       = database.NewPools()
+	ctx           = context.Background()
+
+	// dbPoolStats reports every open connection pool to /admin/pools and /metrics.
+	dbPoolStats = func() map[string]database.Stats { return dbPools.Stats() }
+
+	shutdownTracing = func(context.Context) error { return nil }
+
+	// draining is set on shutdown so /ready fails while in-flight requests finish.
+	draining atomic.Bool
 )
 
-func InitRedis() {
-	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
-		redisClient = redis.NewClient(&redis.Options{
-			Addr: redisURL,
-		})
+// InitTLDRegistry loads the TLD registry from the file named by TLD_CONFIG, falling back to the
+// legacy MYSQL_* env vars, and reloads it on SIGHUP.
+func InitTLDRegistry() {
+	path := os.Getenv("TLD_CONFIG")
+	registry, err := config.Open(path)
+	if err != nil {
+		slog.Error("failed to load TLD config", logging.Err(err))
+		os.Exit(1)
+	}
+	tldRegistry = registry
+	tldRegistry.OnReload(prunePools(registry.Config()))
+	tldRegistry.ReloadOnSignal(syscall.SIGHUP)
 
-		_, err := redisClient.Ping(ctx).Result()
-		if err != nil {
-			log.Printf("Failed to connect to Redis: %v", err)
-			redisClient = nil
-		} else {
-			log.Printf("Successfully connected to Redis at %s", redisURL)
-		}
+	if path != "" {
+		slog.Info("loaded TLD config", slog.String("path", path), slog.Int("tlds", len(tldRegistry.Config().TLDs)))
 	} else {
-		log.Printf("No REDIS_URL provided, running without cache")
+		slog.Info("no TLD_CONFIG provided, loaded TLDs from environment", slog.Int("tlds", len(tldRegistry.Config().TLDs)))
 	}
 }
 
-func getOrSetCache(key string, ttl time.Duration, generator func() []byte) ([]byte, bool, error) {
-	if redisClient == nil {
-		return generator(), false, nil
+// prunePools returns a reload hook closing the pools of databases no longer in the registry. The
+// API key database is only read at startup, so its pool is kept from the startup config.
+func prunePools(startup *config.Config) func(*config.Config) {
+	return func(cfg *config.Config) {
+		active := make(map[string]bool)
+		if db := startup.Auth.Database; db != nil {
+			active[db.ID] = true
+		}
+		for _, tld := range cfg.TLDs {
+			for _, db := range []*config.Database{tld.Dump, tld.Diff} {
+				if db != nil {
+					active[db.ID] = true
+				}
+			}
+		}
+		for _, id := range dbPools.Prune(active) {
+			slog.Info("closing connection pool of removed database", slog.String("database", id))
+		}
 	}
+}
 
-	val, err := redisClient.Get(ctx, key).Bytes()
-	if err == nil {
-		log.Printf("Cache HIT for key: %s", key)
-		return val, true, nil
-	}
-	if err != redis.Nil {
-		log.Printf("Redis error for key %s: %v", key, err)
-		return nil, false, err
+// InitCache sets up the response cache backend selected in the config. When Redis cannot be reached
+// the server keeps running with an in-memory cache.
+func InitCache() {
+	cfg := tldRegistry.Config().Cache
+	c, err := cache.New(ctx, cfg)
+	if err != nil {
+		slog.Warn("cache setup failed, falling back to memory", slog.String("backend", cfg.Backend), logging.Err(err))
+		c = cache.NewMemory(cfg.MaxEntries, cfg.MaxBytes)
+	} else {
+		slog.Info("using response cache", slog.String("backend", cfg.Backend))
 	}
+	responseCache = c
+}
 
-	log.Printf("Cache MISS for key: %s", key)
-	data := generator()
+// CloseCache releases the response cache, for use on server shutdown.
+func CloseCache() error {
+	return responseCache.Close()
+}
 
-	err = redisClient.Set(ctx, key, data, ttl).Err()
+// InitTracing installs the trace exporter selected in the config. When it cannot be created the
+// server keeps running without exporting spans.
+func InitTracing() {
+	cfg := tldRegistry.Config().Tracing
+	shutdown, err := tracing.Init(ctx, cfg)
 	if err != nil {
-		log.Printf("Failed to set cache for key %s: %v", key, err)
-		return data, false, err
+		slog.Warn("tracing setup failed, spans are not exported", logging.Err(err))
+		return
+	}
+	if cfg.Exporter != config.TracingNone {
+		slog.Info("exporting traces", slog.String("exporter", cfg.Exporter))
 	}
+	shutdownTracing = shutdown
+}
 
-	return data, false, nil
+// CloseTracing flushes pending spans, for use on server shutdown.
+func CloseTracing(ctx context.Context) error {
+	return shutdownTracing(ctx)
 }
 
-func dbConn(dbName string, dbUser string, dbPass string) (db *sql.DB, err error) {
-	dbDriver := "mysql"
-	MYSQL_HOSTNAME := os.Getenv("MYSQL_HOSTNAME")
+// dbConn returns the shared connection pool for a configured database.
+func dbConn(ctx context.Context, cfg config.Database) (*sql.DB, error) {
+	return dbPools.Get(ctx, cfg, tldRegistry.Config().Pool)
+}
 
-	// More efficient DSN building using strings.Builder
-	var dsn strings.Builder
-	dsn.WriteString(dbUser)
-	dsn.WriteByte(':')
-	dsn.WriteString(dbPass)
-	dsn.WriteString("@tcp(")
-	dsn.WriteString(MYSQL_HOSTNAME)
-	dsn.WriteString(")/")
-	dsn.WriteString(dbName)
+// ClosePools closes every database connection pool, for use on server shutdown.
+func ClosePools() error {
+	return dbPools.Close()
+}
 
-	db, err = sql.Open(dbDriver, dsn.String())
-	if err != nil {
-		return nil, err
-	}
+func poolStats(w http.ResponseWriter, r *http.Request) {
+	writeValue(w, r, dbPoolStats())
+}
 
-	db.SetMaxOpenConns(100)
-	db.SetMaxIdleConns(50)
-	db.SetConnMaxLifetime(time.Hour)
+// Per-day domain listings in a diff database: domains holds additions, removed holds removals.
+// Both tables share the (dategrp, domain) layout and join on dates.id.
+const (
+	addedTable   = "domains"
+	removedTable = "removed"
+)
 
-	err = db.Ping()
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
+// domainRow is one domain of a listing or search result.
+type domainRow struct {
+	Domain string `json:"domain"`
 }
 
-func sendRows(diffdb string, dbUser string, dbPass string, date int, page int) []byte {
-	db, err := dbConn(diffdb, dbUser, dbPass)
+func sendRows(ctx context.Context, diffdb config.Database, table string, date int, page int) ([]domainRow, error) {
+	defer observeQuery(ctx, "day_listing", fmt.Sprintf("%s %d page %d", table, date, page), time.Now())
+
+	db, err := dbConn(ctx, diffdb)
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return []byte(`{"error": "database connection failed"}`)
+		return nil, errDatabase(err)
 	}
-	defer db.Close()
 
 	var rows2 = page * 20
-	rows, err := db.Query("SELECT domain FROM domains JOIN dates ON domains.dategrp = dates.id WHERE date = ? ORDER BY domain ASC LIMIT 20 OFFSET ?", date, rows2)
+	rows, err := database.Query(ctx, db, "SELECT domain FROM "+table+" JOIN dates ON "+table+".dategrp = dates.id WHERE date = ? ORDER BY domain ASC LIMIT 20 OFFSET ?", date, rows2)
 	if err != nil {
-		log.Printf("Query error: %v", err)
-		return []byte(`{"error": "query failed"}`)
+		return nil, errQuery(err)
 	}
 	defer rows.Close()
 
-	type Rows struct {
-		Domain string `json:"domain"`
-	}
-	var arr []Rows
+	var arr []domainRow
 	for rows.Next() {
 		var domain string
 		if err := rows.Scan(&domain); err != nil {
-			log.Printf("Row scan error: %v", err)
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
 			continue
 		}
-		arr = append(arr, Rows{Domain: domain})
+		arr = append(arr, domainRow{Domain: domain})
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("Rows error: %v", err)
+		return nil, errQuery(err)
 	}
+	return arr, nil
+}
 
-	j, err := json.Marshal(arr)
-	if err != nil {
-		log.Printf("JSON marshal error: %v", err)
-		return []byte(`{"error": "json marshal failed"}`)
-	}
-	return j
+// dateAmounts is one day of a diff database. Amount is the number of added domains, kept for
+// clients predating Added/Removed.
+type dateAmounts struct {
+	Date    int `json:"date"`
+	Amount  int `json:"amount"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
 }
 
-func sendDates(diffdb string, dbUser string, dbPass string, pageordate int) []byte {
-	db, err := dbConn(diffdb, dbUser, dbPass)
+func sendDates(ctx context.Context, diffdb config.Database, pageordate int) ([]dateAmounts, error) {
+	defer observeQuery(ctx, "dates", fmt.Sprintf("page %d", pageordate), time.Now())
+
+	db, err := dbConn(ctx, diffdb)
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return []byte(`{"error": "database connection failed"}`)
+		return nil, errDatabase(err)
 	}
-	defer db.Close()
 
 	var rows2 = pageordate * 20
-	rows, err := db.Query("SELECT date, amount FROM dates ORDER BY date DESC OFFSET ? ROWS FETCH FIRST 20 ROWS ONLY", rows2)
+	rows, err := database.Query(ctx, db, "SELECT date, COALESCE(amount, 0), COALESCE(removed, 0) FROM dates ORDER BY date DESC OFFSET ? ROWS FETCH FIRST 20 ROWS ONLY", rows2)
 	if err != nil {
-		log.Printf("Query error: %v", err)
-		return []byte(`{"error": "query failed"}`)
+		return nil, errQuery(err)
 	}
 	defer rows.Close()
 
-	type Amounts struct {
-		Date   int `json:"date"`
-		Amount int `json:"amount"`
-	}
 	// Pre-allocate slice for better performance
-	arr := make([]Amounts, 0, 20)
+	arr := make([]dateAmounts, 0, 20)
 	for rows.Next() {
 		var date int
-		var amount int
-		if err := rows.Scan(&date, &amount); err != nil {
-			log.Printf("Row scan error: %v", err)
+		var added int
+		var removed int
+		if err := rows.Scan(&date, &added, &removed); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
 			continue
 		}
-		arr = append(arr, Amounts{Date: date, Amount: amount})
+		arr = append(arr, dateAmounts{Date: date, Amount: added, Added: added, Removed: removed})
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Rows error: %v", err)
-		return []byte(`{"error": "rows iteration failed"}`)
-	}
-
-	j, err := json.Marshal(arr)
-	if err != nil {
-		log.Printf("JSON marshal error: %v", err)
-		return []byte(`{"error": "json marshal failed"}`)
+		return nil, errQuery(err)
 	}
-	return j
+	return arr, nil
 }
 
-func searchDomain(dumpdb, dbUser, dbPass, query string) []byte {
-	db, err := dbConn(dumpdb, dbUser, dbPass)
-	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return []byte(`{"error": "database connection failed"}`)
-	}
-	defer db.Close()
-
-	rows, err := db.Query("SELECT domain FROM domains WHERE domain LIKE ? ORDER BY CHAR_LENGTH(domain) ASC", "%"+query+"%")
-	if err != nil {
-		log.Printf("Query error: %v", err)
-		return []byte(`{"error": "query failed"}`)
-	}
-	defer rows.Close()
-
-	type Rows struct {
-		Domain string `json:"domain"`
-	}
-	var arr []Rows
-	for rows.Next() {
-		var domain string
-		rows.Scan(&domain)
-		a := Rows{Domain: domain}
-		arr = append(arr, a)
-	}
-	j, _ := json.Marshal(arr)
-	return j
+// zoneSize is the number of domains in a dump database on one day.
+type zoneSize struct {
+	Date   string `json:"date"`
+	Amount int    `json:"amount"`
 }
 
-func domainAmounts(dumpdb, dbUser, dbPass string) []byte {
-	type DateAmount struct {
-		Date   string `json:"date"`
-		Amount int    `json:"amount"`
-	}
+func domainAmounts(ctx context.Context, dumpdb config.Database) ([]zoneSize, error) {
+	defer observeQuery(ctx, "stats", dumpdb.ID, time.Now())
 
-	db, err := dbConn(dumpdb, dbUser, dbPass)
+	db, err := dbConn(ctx, dumpdb)
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return []byte(`{"error": "database connection failed"}`)
+		return nil, errDatabase(err)
 	}
-	defer db.Close()
 
-	rows, err := db.Query("SELECT date, amount FROM dates")
+	rows, err := database.Query(ctx, db, "SELECT date, amount FROM dates")
 	if err != nil {
-		log.Printf("Query error: %v", err)
-		return []byte(`{"error": "query failed"}`)
+		return nil, errQuery(err)
 	}
 	defer rows.Close()
 
 	// Pre-allocate slice with estimated capacity
-	results := make([]DateAmount, 0, 100)
+	results := make([]zoneSize, 0, 100)
 
 	for rows.Next() {
-		var da DateAmount
+		var da zoneSize
 		err := rows.Scan(&da.Date, &da.Amount)
 		if err != nil {
-			log.Printf("Row scan error: %v", err)
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
 			continue
 		}
 
 		parsedDate, err := time.Parse("20060102", da.Date)
 		if err != nil {
-			log.Printf("Date parsing error: %v", err)
+			slog.WarnContext(ctx, "date parsing failed", logging.Err(err))
 			continue
 		}
 		da.Date = parsedDate.Format("2006-01-02")
@@ -306,17 +262,9 @@ func domainAmounts(dumpdb, dbUser, dbPass string) []byte {
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("Rows error: %v", err)
-		return []byte(`{"error": "rows iteration failed"}`)
-	}
-
-	jsonData, err := json.Marshal(results)
-	if err != nil {
-		log.Printf("JSON marshal error: %v", err)
-		return []byte(`{"error": "json marshal failed"}`)
+		return nil, errQuery(err)
 	}
-
-	return jsonData
+	return results, nil
 }
 
 const (
@@ -326,236 +274,185 @@ const (
 	DayTTL    = 24 * time.Hour
 )
 
-func sendSEDates(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) != 2 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+func diffDates(w http.ResponseWriter, r *http.Request) {
+	if parts, err := getPathParams(r.URL.Path, 2); err == nil {
+		serveDiffDatesCursor(w, r, parts[1])
 		return
 	}
 
-	page, err := strconv.Atoi(pathParts[1])
+	parts, err := getPathParams(r.URL.Path, 3)
 	if err != nil {
-		http.Error(w, "Invalid page number", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	// More efficient cache key generation
-	cacheKey := "sedates:page:" + strconv.Itoa(page)
-
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return sendDates(os.Getenv("MYSQL_SE_DATABASE"), os.Getenv("MYSQL_SE_USERNAME"), os.Getenv("MYSQL_SE_PASSWORD"), page)
-	})
+	serveDiffDates(w, r, parts[1], parts[2])
+}
 
-	if err != nil {
-		log.Printf("Cache error: %v", err)
+func diffRows(w http.ResponseWriter, r *http.Request) {
+	if parts, err := getPathParams(r.URL.Path, 3); err == nil {
+		serveDayListingCursor(w, r, parts[1], config.EndpointDomains, "rows", addedTable, parts[2])
+		return
 	}
 
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
+	parts, err := getPathParams(r.URL.Path, 4)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Write(result)
+	serveDiffRows(w, r, parts[1], parts[2], parts[3])
 }
 
-func sendNUDates(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) != 2 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+func diffRemovedRows(w http.ResponseWriter, r *http.Request) {
+	if parts, err := getPathParams(r.URL.Path, 3); err == nil {
+		serveDayListingCursor(w, r, parts[1], config.EndpointRemoved, "removed", removedTable, parts[2])
 		return
 	}
 
-	page, err := strconv.Atoi(pathParts[1])
+	parts, err := getPathParams(r.URL.Path, 4)
 	if err != nil {
-		http.Error(w, "Invalid page number", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	// More efficient cache key generation
-	cacheKey := "nudates:page:" + strconv.Itoa(page)
-
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return sendDates(os.Getenv("MYSQL_NU_DATABASE"), os.Getenv("MYSQL_NU_USERNAME"), os.Getenv("MYSQL_NU_PASSWORD"), page)
-	})
+	serveRemovedRows(w, r, parts[1], parts[2], parts[3])
+}
 
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
+// legacyDiffDates serves the old /{tld}/{page} routes (e.g. /se/0) for a fixed TLD.
+func legacyDiffDates(tld string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts, err := getPathParams(r.URL.Path, 2)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
+		serveDiffDates(w, r, tld, parts[1])
 	}
-
-	w.Write(result)
 }
 
-func sendSERows(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) != 3 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-		return
+// legacyDiffRows serves the old /{tld}domains/{date}/{page} routes (e.g. /sedomains/20250314/0) for a fixed TLD.
+func legacyDiffRows(tld string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts, err := getPathParams(r.URL.Path, 3)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		serveDiffRows(w, r, tld, parts[1], parts[2])
 	}
+}
 
-	date, err := strconv.Atoi(pathParts[1])
+func serveDiffDates(w http.ResponseWriter, r *http.Request, tld string, pageParam string) {
+	db, err := getDiffDatabase(tld, config.EndpointDates)
 	if err != nil {
-		http.Error(w, "Invalid date number", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	page, err := strconv.Atoi(pathParts[2])
+	page, err := strconv.Atoi(pageParam)
 	if err != nil {
-		http.Error(w, "Invalid page number", http.StatusBadRequest)
+		writeError(w, r, badRequest("invalid_page", "invalid page number"))
 		return
 	}
 
-	// More efficient cache key generation using strings.Builder
-	var keyBuilder strings.Builder
-	keyBuilder.WriteString("serows:date:")
-	keyBuilder.WriteString(strconv.Itoa(date))
-	keyBuilder.WriteString(":page:")
-	keyBuilder.WriteString(strconv.Itoa(page))
-	cacheKey := keyBuilder.String()
+	cacheKey := tld + "dates:page:" + strconv.Itoa(page)
 
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return sendRows(os.Getenv("MYSQL_SE_DATABASE"), os.Getenv("MYSQL_SE_USERNAME"), os.Getenv("MYSQL_SE_PASSWORD"), date, page)
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags(tld, cache.DatasetDiff), func(ctx context.Context) ([]dateAmounts, error) {
+		return sendDates(ctx, db, page)
 	})
+}
 
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
+func serveDiffRows(w http.ResponseWriter, r *http.Request, tld string, dateParam string, pageParam string) {
+	serveDayListing(w, r, tld, config.EndpointDomains, "rows", addedTable, dateParam, pageParam)
+}
 
-	w.Write(result)
+func serveRemovedRows(w http.ResponseWriter, r *http.Request, tld string, dateParam string, pageParam string) {
+	serveDayListing(w, r, tld, config.EndpointRemoved, "removed", removedTable, dateParam, pageParam)
 }
 
-func sendNURows(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) != 3 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+// serveDayListing serves one page of a per-day domain listing from a TLD's diff database.
+// kind namespaces the cache key, e.g. "serows:date:20250314:page:0".
+func serveDayListing(w http.ResponseWriter, r *http.Request, tld string, endpoint string, kind string, table string, dateParam string, pageParam string) {
+	db, err := getDiffDatabase(tld, endpoint)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	date, err := strconv.Atoi(pathParts[1])
+	date, err := strconv.Atoi(dateParam)
 	if err != nil {
-		http.Error(w, "Invalid date number", http.StatusBadRequest)
+		writeError(w, r, badRequest("invalid_date", "invalid date number"))
 		return
 	}
 
-	page, err := strconv.Atoi(pathParts[2])
+	page, err := strconv.Atoi(pageParam)
 	if err != nil {
-		http.Error(w, "Invalid page number", http.StatusBadRequest)
+		writeError(w, r, badRequest("invalid_page", "invalid page number"))
 		return
 	}
 
 	// More efficient cache key generation using strings.Builder
 	var keyBuilder strings.Builder
-	keyBuilder.WriteString("nurows:date:")
+	keyBuilder.WriteString(tld)
+	keyBuilder.WriteString(kind)
+	keyBuilder.WriteString(":date:")
 	keyBuilder.WriteString(strconv.Itoa(date))
 	keyBuilder.WriteString(":page:")
 	keyBuilder.WriteString(strconv.Itoa(page))
 	cacheKey := keyBuilder.String()
 
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return sendRows(os.Getenv("MYSQL_NU_DATABASE"), os.Getenv("MYSQL_NU_USERNAME"), os.Getenv("MYSQL_NU_PASSWORD"), date, page)
-	})
-
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
-
-	w.Write(result)
-}
-
-func domainSearch(w http.ResponseWriter, r *http.Request) {
-	parts, err := getPathParams(r.URL.Path, 3)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	tld, query := parts[1], parts[2]
-	db, user, pass, err := getTLDEnvVars(tld)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	cacheKey := fmt.Sprintf("search:%s:%s", tld, query)
-
-	result, cacheHit, err := getOrSetCache(cacheKey, ShortTTL, func() []byte {
-		return searchDomain(db, user, pass, query)
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags(tld, cache.DatasetDiff), func(ctx context.Context) ([]domainRow, error) {
+		return sendRows(ctx, db, table, date, page)
 	})
-
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
-
-	w.Write(result)
 }
 
 func domainStats(w http.ResponseWriter, r *http.Request) {
 	parts, err := getPathParams(r.URL.Path, 2)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	tld := parts[1]
-	db, user, pass, err := getTLDEnvVars(tld)
+	db, err := getDumpDatabase(tld, config.EndpointStats)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	cacheKey := fmt.Sprintf("stats:%s", tld)
 
-	result, cacheHit, err := getOrSetCache(cacheKey, LongTTL, func() []byte {
-		return domainAmounts(db, user, pass)
+	serveCached(w, r, cacheKey, LongTTL, cache.Tags(tld, cache.DatasetDump), func(ctx context.Context) ([]zoneSize, error) {
+		return domainAmounts(ctx, db)
 	})
+}
 
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
-
-	w.Write(result)
+// Drain makes the readiness probe fail so load balancers stop sending requests, for use at the
+// start of a graceful shutdown.
+func Drain() {
+	draining.Store(true)
 }
 
 func readyness(w http.ResponseWriter, r *http.Request) {
-	dbs := []models.DbConfig{
-		{Database: os.Getenv("MYSQL_NU_DATABASE"), Username: os.Getenv("MYSQL_NU_USERNAME"), Password: os.Getenv("MYSQL_NU_PASSWORD"), Name: "NU"},
-		{Database: os.Getenv("MYSQL_SE_DATABASE"), Username: os.Getenv("MYSQL_SE_USERNAME"), Password: os.Getenv("MYSQL_SE_PASSWORD"), Name: "SE"},
-		{Database: os.Getenv("MYSQL_SEDUMP_DATABASE"), Username: os.Getenv("MYSQL_SEDUMP_USERNAME"), Password: os.Getenv("MYSQL_SEDUMP_PASSWORD"), Name: "SE dump"},
-		{Database: os.Getenv("MYSQL_NUDUMP_DATABASE"), Username: os.Getenv("MYSQL_NUDUMP_USERNAME"), Password: os.Getenv("MYSQL_NUDUMP_PASSWORD"), Name: "NU dump"},
-		{Database: os.Getenv("MYSQL_CHDUMP_DATABASE"), Username: os.Getenv("MYSQL_CHDUMP_USERNAME"), Password: os.Getenv("MYSQL_CHDUMP_PASSWORD"), Name: "CH dump"},
-		{Database: os.Getenv("MYSQL_LIDUMP_DATABASE"), Username: os.Getenv("MYSQL_LIDUMP_USERNAME"), Password: os.Getenv("MYSQL_LIDUMP_PASSWORD"), Name: "LI dump"},
-		{Database: os.Getenv("MYSQL_EEDUMP_DATABASE"), Username: os.Getenv("MYSQL_EEDUMP_USERNAME"), Password: os.Getenv("MYSQL_EEDUMP_PASSWORD"), Name: "EE dump"},
-		{Database: os.Getenv("MYSQL_SKDUMP_DATABASE"), Username: os.Getenv("MYSQL_SKDUMP_USERNAME"), Password: os.Getenv("MYSQL_SKDUMP_PASSWORD"), Name: "SK dump"},
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Shutting down"))
+		return
+	}
+
+	cfg := tldRegistry.Config()
+	var dbs []models.DbConfig
+	for _, name := range cfg.Names() {
+		tld := cfg.TLDs[name]
+		if tld.Diff != nil {
+			dbs = append(dbs, dbConfig(*tld.Diff, tld.DisplayName))
+		}
+		if tld.Dump != nil {
+			dbs = append(dbs, dbConfig(*tld.Dump, tld.DisplayName+" dump"))
+		}
 	}
 
 	if err := health.CheckDatabases(dbs); err != nil {
@@ -568,29 +465,44 @@ func readyness(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("All database connections successful"))
 }
 
+func dbConfig(db config.Database, name string) models.DbConfig {
+	return models.DbConfig{
+		Host:     db.Host,
+		Database: db.Name,
+		Username: db.Username,
+		Password: db.Password,
+		DbName:   name,
+		Name:     name,
+	}
+}
+
 func liveness(w http.ResponseWriter, r *http.Request) {
-	MYSQL_HOSTNAME := os.Getenv("MYSQL_HOSTNAME")
-	dbDriver := "mysql"
-	dbUser := os.Getenv("MYSQL_SE_USERNAME")
-	dbPass := os.Getenv("MYSQL_SE_PASSWORD")
-	dbName := os.Getenv("MYSQL_SE_DATABASE")
+	// Any configured database will do, the probe only checks that the MySQL server answers.
+	var target *config.Database
+	cfg := tldRegistry.Config()
+	if names := cfg.Names(); len(names) > 0 {
+		tld := cfg.TLDs[names[0]]
+		target = tld.Diff
+		if target == nil {
+			target = tld.Dump
+		}
+	}
 
-	if dbUser == "" || dbPass == "" || dbName == "" {
+	if target == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("MySQL configuration not available"))
 		return
 	}
 
-	db, err := sql.Open(dbDriver, dbUser+":"+dbPass+"@tcp"+"("+MYSQL_HOSTNAME+")"+"/"+dbName)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := dbPools.Get(ctx, *target, cfg.Pool)
 	if err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("MySQL server connection failed"))
 		return
 	}
-	defer db.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
 	err = db.PingContext(ctx)
 	if err != nil {
@@ -603,37 +515,76 @@ func liveness(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("MySQL server is healthy"))
 }
 
-func getTLDEnvVars(tld string) (string, string, string, error) {
-	config, ok := tldConfigs[tld]
+// getDumpDatabase resolves the dump database of a TLD that has endpoint enabled.
+func getDumpDatabase(tld string, endpoint string) (config.Database, error) {
+	entry, err := lookupTLD(tld, endpoint)
+	if err != nil {
+		return config.Database{}, err
+	}
+	if entry.Dump == nil {
+		return config.Database{}, notFound("endpoint_not_enabled", "no dump database for TLD: "+tld)
+	}
+	return *entry.Dump, nil
+}
+
+// getDiffDatabase resolves the diff database of a TLD that has endpoint enabled.
+func getDiffDatabase(tld string, endpoint string) (config.Database, error) {
+	entry, err := lookupTLD(tld, endpoint)
+	if err != nil {
+		return config.Database{}, err
+	}
+	if entry.Diff == nil {
+		return config.Database{}, notFound("endpoint_not_enabled", "no diff database for TLD: "+tld)
+	}
+	return *entry.Diff, nil
+}
+
+func lookupTLD(tld string, endpoint string) (*config.TLD, error) {
+	entry, ok := tldRegistry.Lookup(tld)
 	if !ok {
-		return "", "", "", fmt.Errorf("unsupported TLD: %s", tld)
+		return nil, notFound("unknown_tld", "unsupported TLD: "+tld)
 	}
-	return os.Getenv(config.Database), os.Getenv(config.Username), os.Getenv(config.Password), nil
+	if !entry.Enabled(endpoint) {
+		return nil, notFound("endpoint_not_enabled", fmt.Sprintf("endpoint %s is not enabled for TLD: %s", endpoint, tld))
+	}
+	return entry, nil
 }
 
 func getPathParams(path string, expectedParts int) ([]string, error) {
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 	if len(parts) != expectedParts {
-		return nil, fmt.Errorf("invalid path: expected %d parts, got %d", expectedParts, len(parts))
+		return nil, badRequest("invalid_path", fmt.Sprintf("invalid path: expected %d parts, got %d", expectedParts, len(parts)))
 	}
 	return parts, nil
 }
 
-func getDomainFirstAppearance(dumpdb, dbUser, dbPass, query string) []byte {
-	start := time.Now()
-	defer func() {
-		duration := time.Since(start)
-		if duration > time.Second {
-			log.Printf("Slow query warning: getDomainFirstAppearance took %v for query: %s", duration, query)
-		}
-	}()
+// slowQueryThreshold is the duration above which a query is logged and counted as slow.
+const slowQueryThreshold = time.Second
+
+// observeQuery records the duration of a named query, and logs and counts it when it was slower
+// than slowQueryThreshold. detail identifies the query in the log, e.g. the search term.
+// Use as defer observeQuery(ctx, name, detail, time.Now()).
+func observeQuery(ctx context.Context, name string, detail string, start time.Time) {
+	duration := time.Since(start)
+	metrics.QueryDuration.WithLabelValues(name).Observe(duration.Seconds())
+	if duration > slowQueryThreshold {
+		metrics.SlowQueries.WithLabelValues(name).Inc()
+		slog.WarnContext(ctx, "slow query", slog.String("query", name), slog.String("detail", detail), slog.Duration("duration", duration))
+	}
+}
 
-	db, err := dbConn(dumpdb, dbUser, dbPass)
+// firstAppearance is the first day a domain was seen, nil when it never was.
+type firstAppearance struct {
+	EarliestDate *string `json:"earliest_date"`
+}
+
+func getDomainFirstAppearance(ctx context.Context, diffdb config.Database, query string) (firstAppearance, error) {
+	defer observeQuery(ctx, "appearance", query, time.Now())
+
+	db, err := dbConn(ctx, diffdb)
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return []byte(`{"error": "database connection failed"}`)
+		return firstAppearance{}, errDatabase(err)
 	}
-	defer db.Close()
 
 	var earliestDate sql.NullString
 	var queryStmt string
@@ -655,102 +606,64 @@ func getDomainFirstAppearance(dumpdb, dbUser, dbPass, query string) []byte {
 		queryArgs = []interface{}{query}
 	}
 
-	err = db.QueryRow(queryStmt, queryArgs...).Scan(&earliestDate)
+	err = database.QueryRow(ctx, db, queryStmt, queryArgs...).Scan(&earliestDate)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return []byte(`{"earliest_date": null}`)
+			return firstAppearance{}, nil
 		}
-		log.Printf("Query error: %v", err)
-		return []byte(`{"error": "query failed"}`)
+		return firstAppearance{}, errQuery(err)
 	}
 
 	if !earliestDate.Valid {
-		return []byte(`{"earliest_date": null}`)
+		return firstAppearance{}, nil
 	}
 
 	parsedDate, err := time.Parse("20060102", earliestDate.String)
 	if err != nil {
-		log.Printf("Date parsing error: %v", err)
-		return []byte(`{"error": "date parsing failed"}`)
+		return firstAppearance{}, internalError("invalid_date", "date parsing failed", err)
 	}
 	formattedDate := parsedDate.Format("2006-01-02")
-
-	result := struct {
-		EarliestDate string `json:"earliest_date"`
-	}{
-		EarliestDate: formattedDate,
-	}
-
-	j, err := json.Marshal(result)
-	if err != nil {
-		log.Printf("JSON marshal error: %v", err)
-		return []byte(`{"error": "json marshal failed"}`)
-	}
-	return j
+	return firstAppearance{EarliestDate: &formattedDate}, nil
 }
 
 func seDomainFirstAppearance(w http.ResponseWriter, r *http.Request) {
 	parts, err := getPathParams(r.URL.Path, 2)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	query := parts[1]
-	db, user, pass, err := getTLDEnvVars("se_diff")
+	db, err := getDiffDatabase("se", config.EndpointAppearance)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	cacheKey := fmt.Sprintf("seappearance:%s", query)
 
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return getDomainFirstAppearance(db, user, pass, query)
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags("se", cache.DatasetDiff), func(ctx context.Context) (firstAppearance, error) {
+		return getDomainFirstAppearance(ctx, db, query)
 	})
-
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
-
-	w.Write(result)
 }
 
 func nuDomainFirstAppearance(w http.ResponseWriter, r *http.Request) {
 	parts, err := getPathParams(r.URL.Path, 2)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	query := parts[1]
-	db, user, pass, err := getTLDEnvVars("nu_diff")
+	db, err := getDiffDatabase("nu", config.EndpointAppearance)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	cacheKey := fmt.Sprintf("nuappearance:%s", query)
 
-	result, cacheHit, err := getOrSetCache(cacheKey, MediumTTL, func() []byte {
-		return getDomainFirstAppearance(db, user, pass, query)
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags("nu", cache.DatasetDiff), func(ctx context.Context) (firstAppearance, error) {
+		return getDomainFirstAppearance(ctx, db, query)
 	})
-
-	if err != nil {
-		log.Printf("Cache error: %v", err)
-	}
-
-	if cacheHit {
-		w.Header().Set("X-Cache", "HIT")
-	} else {
-		w.Header().Set("X-Cache", "MISS")
-	}
-
-	w.Write(result)
 }
@@ -1,10 +1,21 @@
 package api
 
 import (
-	"os"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
+// swap sets a package global such as tldRegistry or responseCache for the rest of the test and
+// restores its previous value when the test ends.
+func swap[T any](t *testing.T, global *T, value T) {
+	t.Helper()
+	orig := *global
+	*global = value
+	t.Cleanup(func() { *global = orig })
+}
+
 func TestGetPathParams(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -79,35 +90,26 @@ func TestGetPathParams(t *testing.T) {
 	}
 }
 
-func TestGetTLDEnvVars(t *testing.T) {
-	// Save original environment
-	originalSeDb := os.Getenv("MYSQL_SEDUMP_DATABASE")
-	originalSeUser := os.Getenv("MYSQL_SEDUMP_USERNAME")
-	originalSePass := os.Getenv("MYSQL_SEDUMP_PASSWORD")
+func TestGetDumpDatabase(t *testing.T) {
+	t.Setenv("MYSQL_HOSTNAME", "db.example")
+	t.Setenv("MYSQL_SEDUMP_DATABASE", "test_se_db")
+	t.Setenv("MYSQL_SEDUMP_USERNAME", "test_se_user")
+	t.Setenv("MYSQL_SEDUMP_PASSWORD", "test_se_pass")
+	t.Setenv("MYSQL_NUDUMP_DATABASE", "test_nu_db")
+	t.Setenv("MYSQL_NUDUMP_USERNAME", "test_nu_user")
+	t.Setenv("MYSQL_NUDUMP_PASSWORD", "test_nu_pass")
+	t.Setenv("MYSQL_CH_DATABASE", "test_ch_diff_db")
 
-	// Clean up after test
-	defer func() {
-		if originalSeDb != "" {
-			os.Setenv("MYSQL_SEDUMP_DATABASE", originalSeDb)
-		} else {
-			os.Unsetenv("MYSQL_SEDUMP_DATABASE")
-		}
-		if originalSeUser != "" {
-			os.Setenv("MYSQL_SEDUMP_USERNAME", originalSeUser)
-		} else {
-			os.Unsetenv("MYSQL_SEDUMP_USERNAME")
-		}
-		if originalSePass != "" {
-			os.Setenv("MYSQL_SEDUMP_PASSWORD", originalSePass)
-		} else {
-			os.Unsetenv("MYSQL_SEDUMP_PASSWORD")
-		}
-	}()
+	cfg, err := config.FromEnv()
+	if err != nil {
+		t.Fatalf("config.FromEnv() error = %v", err)
+	}
+	swap(t, &tldRegistry, config.NewRegistry(cfg))
 
 	tests := []struct {
 		name     string
 		tld      string
-		setEnv   bool
+		endpoint string
 		wantErr  bool
 		wantDb   string
 		wantUser string
@@ -116,7 +118,7 @@ func TestGetTLDEnvVars(t *testing.T) {
 		{
 			name:     "valid TLD se",
 			tld:      "se",
-			setEnv:   true,
+			endpoint: config.EndpointSearch,
 			wantErr:  false,
 			wantDb:   "test_se_db",
 			wantUser: "test_se_user",
@@ -125,7 +127,7 @@ func TestGetTLDEnvVars(t *testing.T) {
 		{
 			name:     "valid TLD nu",
 			tld:      "nu",
-			setEnv:   true,
+			endpoint: config.EndpointStats,
 			wantErr:  false,
 			wantDb:   "test_nu_db",
 			wantUser: "test_nu_user",
@@ -134,61 +136,141 @@ func TestGetTLDEnvVars(t *testing.T) {
 		{
 			name:     "invalid TLD",
 			tld:      "invalid",
-			setEnv:   false,
+			endpoint: config.EndpointSearch,
 			wantErr:  true,
-			wantDb:   "",
-			wantUser: "",
-			wantPass: "",
 		},
 		{
-			name:     "se_diff TLD",
-			tld:      "se_diff",
-			setEnv:   true,
-			wantErr:  false,
-			wantDb:   "test_se_diff_db",
-			wantUser: "test_se_diff_user",
-			wantPass: "test_se_diff_pass",
+			name:     "TLD without dump database",
+			tld:      "ch",
+			endpoint: config.EndpointSearch,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown TLD without env",
+			tld:      "sk",
+			endpoint: config.EndpointSearch,
+			wantErr:  true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.setEnv {
-				// Set environment variables based on TLD config
-				config, ok := tldConfigs[tt.tld]
-				if ok {
-					os.Setenv(config.Database, tt.wantDb)
-					os.Setenv(config.Username, tt.wantUser)
-					os.Setenv(config.Password, tt.wantPass)
-				}
-			}
-
-			db, user, pass, err := getTLDEnvVars(tt.tld)
+			db, err := getDumpDatabase(tt.tld, tt.endpoint)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("getTLDEnvVars() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("getDumpDatabase() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !tt.wantErr {
-				if db != tt.wantDb {
-					t.Errorf("getTLDEnvVars() db = %v, want %v", db, tt.wantDb)
+				if db.Name != tt.wantDb {
+					t.Errorf("getDumpDatabase() db = %v, want %v", db.Name, tt.wantDb)
+				}
+				if db.Username != tt.wantUser {
+					t.Errorf("getDumpDatabase() user = %v, want %v", db.Username, tt.wantUser)
 				}
-				if user != tt.wantUser {
-					t.Errorf("getTLDEnvVars() user = %v, want %v", user, tt.wantUser)
+				if db.Password != tt.wantPass {
+					t.Errorf("getDumpDatabase() pass = %v, want %v", db.Password, tt.wantPass)
 				}
-				if pass != tt.wantPass {
-					t.Errorf("getTLDEnvVars() pass = %v, want %v", pass, tt.wantPass)
+				if db.Host != "db.example" {
+					t.Errorf("getDumpDatabase() host = %v, want db.example", db.Host)
 				}
 			}
+		})
+	}
+}
 
-			// Clean up environment variables after each test
-			if tt.setEnv {
-				config, ok := tldConfigs[tt.tld]
-				if ok {
-					os.Unsetenv(config.Database)
-					os.Unsetenv(config.Username)
-					os.Unsetenv(config.Password)
-				}
+func TestGetDiffDatabase(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{
+		TLDs: map[string]*config.TLD{
+			"se": {
+				Dump:      &config.Database{Name: "test_se_db"},
+				Diff:      &config.Database{Name: "test_se_diff_db"},
+				Endpoints: []string{config.EndpointDates, config.EndpointDomains, config.EndpointAppearance},
+			},
+			"ch": {
+				Diff:      &config.Database{Name: "test_ch_diff_db"},
+				Endpoints: []string{config.EndpointDates},
+			},
+			"li": {
+				Dump:      &config.Database{Name: "test_li_db"},
+				Endpoints: []string{config.EndpointSearch},
+			},
+		},
+	}))
+
+	tests := []struct {
+		name     string
+		tld      string
+		endpoint string
+		wantErr  bool
+		wantDb   string
+	}{
+		{
+			name:     "se diff",
+			tld:      "se",
+			endpoint: config.EndpointDates,
+			wantErr:  false,
+			wantDb:   "test_se_diff_db",
+		},
+		{
+			name:     "ch diff",
+			tld:      "ch",
+			endpoint: config.EndpointDates,
+			wantErr:  false,
+			wantDb:   "test_ch_diff_db",
+		},
+		{
+			name:     "endpoint not enabled",
+			tld:      "ch",
+			endpoint: config.EndpointDomains,
+			wantErr:  true,
+		},
+		{
+			name:     "removed listing not enabled",
+			tld:      "ch",
+			endpoint: config.EndpointRemoved,
+			wantErr:  true,
+		},
+		{
+			name:     "TLD without diff database",
+			tld:      "li",
+			endpoint: config.EndpointSearch,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown TLD",
+			tld:      "invalid",
+			endpoint: config.EndpointDates,
+			wantErr:  true,
+		},
+		{
+			name:     "diff suffix is not a TLD",
+			tld:      "se_diff",
+			endpoint: config.EndpointDates,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := getDiffDatabase(tt.tld, tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getDiffDatabase() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && db.Name != tt.wantDb {
+				t.Errorf("getDiffDatabase() db = %v, want %v", db.Name, tt.wantDb)
 			}
 		})
 	}
 }
+
+func TestReadynessWhileDraining(t *testing.T) {
+	Drain()
+	defer draining.Store(false)
+
+	rr := httptest.NewRecorder()
+	readyness(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyness() status while draining = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
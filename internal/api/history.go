@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// lifecycleEvent is one day on which a domain entered or left the zone, as recorded in a diff database.
+type lifecycleEvent struct {
+	Date    string
+	Removed bool
+}
+
+// interval is a continuous period of presence in the zone. Added is nil when the domain was already
+// present before the diff database started tracking, Removed is nil while the domain is still present.
+type interval struct {
+	Added   *string `json:"added"`
+	Removed *string `json:"removed"`
+}
+
+// historyResult is the /history response. Inconsistent is set when the diff events disagree with the
+// dump about whether the domain is registered now.
+type historyResult struct {
+	Domain        string     `json:"domain"`
+	Registered    bool       `json:"registered"`
+	Inconsistent  bool       `json:"inconsistent"`
+	FirstSeen     *string    `json:"first_seen"`
+	Registrations int        `json:"registrations"`
+	Intervals     []interval `json:"intervals"`
+}
+
+// buildIntervals folds date-ordered events into presence intervals. Repeated additions without a
+// removal in between, and repeated removals, are treated as the same transition. A domain registered
+// in the dump without any event was present since before tracking and gets an open interval with an
+// unknown start. When the events disagree with the dump, consistent is false: a domain registered
+// after a removal gets an open interval added on snapshot, the date of the dump, and a domain not
+// registered keeps its open interval.
+func buildIntervals(events []lifecycleEvent, registered bool, snapshot string) (intervals []interval, consistent bool) {
+	intervals = make([]interval, 0, len(events)/2+1)
+	present := false
+	for _, ev := range events {
+		date := ev.Date
+		switch {
+		case !ev.Removed && !present:
+			intervals = append(intervals, interval{Added: &date})
+			present = true
+		case ev.Removed && present:
+			intervals[len(intervals)-1].Removed = &date
+			present = false
+		case ev.Removed && len(intervals) == 0:
+			intervals = append(intervals, interval{Removed: &date})
+		}
+	}
+	switch {
+	case registered && len(events) == 0:
+		intervals = append(intervals, interval{})
+	case registered && !present:
+		var added *string
+		if snapshot != "" {
+			added = &snapshot
+		}
+		return append(intervals, interval{Added: added}), false
+	case !registered && present:
+		return intervals, false
+	}
+	return intervals, true
+}
+
+func formatDiffDate(date string) (string, error) {
+	parsed, err := time.Parse("20060102", date)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Format("2006-01-02"), nil
+}
+
+func getDomainHistory(ctx context.Context, dumpdb config.Database, diffdb config.Database, domain string) (*historyResult, error) {
+	defer observeQuery(ctx, "history", domain, time.Now())
+
+	diff, err := dbConn(ctx, diffdb)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	// Removals sort before additions on the same day so a same-day re-registration opens a new interval.
+	rows, err := database.Query(ctx, diff, `
+		SELECT dt.date, 0 AS removed FROM domains d JOIN dates dt ON d.dategrp = dt.id WHERE d.domain = ?
+		UNION ALL
+		SELECT dt.date, 1 AS removed FROM removed r JOIN dates dt ON r.dategrp = dt.id WHERE r.domain = ?
+		ORDER BY date ASC, removed DESC`, domain, domain)
+	if err != nil {
+		return nil, errQuery(err)
+	}
+	defer rows.Close()
+
+	var events []lifecycleEvent
+	for rows.Next() {
+		var date string
+		var removed bool
+		if err := rows.Scan(&date, &removed); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+			continue
+		}
+		formatted, err := formatDiffDate(date)
+		if err != nil {
+			slog.WarnContext(ctx, "date parsing failed", logging.Err(err))
+			continue
+		}
+		events = append(events, lifecycleEvent{Date: formatted, Removed: removed})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errQuery(err)
+	}
+
+	dump, err := dbConn(ctx, dumpdb)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	var snapshot string
+	err = database.QueryRow(ctx, dump, "SELECT date FROM dates ORDER BY date DESC LIMIT 1").Scan(&snapshot)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errQuery(err)
+	}
+	if snapshot != "" {
+		if snapshot, err = formatDiffDate(snapshot); err != nil {
+			slog.WarnContext(ctx, "date parsing failed", logging.Err(err))
+			snapshot = ""
+		}
+	}
+
+	var one int
+	err = database.QueryRow(ctx, dump, "SELECT 1 FROM domains WHERE domain = ? LIMIT 1", domain).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errQuery(err)
+	}
+
+	registered := err == nil
+	intervals, consistent := buildIntervals(events, registered, snapshot)
+	history := historyResult{
+		Domain:       domain,
+		Registered:   registered,
+		Inconsistent: !consistent,
+		Intervals:    intervals,
+	}
+	for _, iv := range history.Intervals {
+		if iv.Added != nil {
+			history.Registrations++
+			if history.FirstSeen == nil {
+				history.FirstSeen = iv.Added
+			}
+		}
+	}
+
+	return &history, nil
+}
+
+func domainHistory(w http.ResponseWriter, r *http.Request) {
+	parts, err := getPathParams(r.URL.Path, 3)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tld := parts[1]
+	domain := strings.TrimSuffix(strings.ToLower(parts[2]), ".")
+
+	dumpdb, err := getDumpDatabase(tld, config.EndpointHistory)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	diffdb, err := getDiffDatabase(tld, config.EndpointHistory)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cacheKey := fmt.Sprintf("history:%s:%s", tld, domain)
+
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags(tld, cache.DatasetDump, cache.DatasetDiff), func(ctx context.Context) (*historyResult, error) {
+		return getDomainHistory(ctx, dumpdb, diffdb, domain)
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestBuildIntervals(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name       string
+		events     []lifecycleEvent
+		registered bool
+		want       []interval
+		// inconsistent is set for the cases where the events disagree with the dump.
+		inconsistent bool
+	}{
+		{
+			name:   "no events",
+			events: nil,
+			want:   []interval{},
+		},
+		{
+			name:       "still present",
+			events:     []lifecycleEvent{{Date: "2025-03-14"}},
+			registered: true,
+			want:       []interval{{Added: str("2025-03-14")}},
+		},
+		{
+			name: "re-registered",
+			events: []lifecycleEvent{
+				{Date: "2024-01-01"},
+				{Date: "2024-06-01", Removed: true},
+				{Date: "2025-03-14"},
+			},
+			registered: true,
+			want: []interval{
+				{Added: str("2024-01-01"), Removed: str("2024-06-01")},
+				{Added: str("2025-03-14")},
+			},
+		},
+		{
+			name: "removed before tracking started",
+			events: []lifecycleEvent{
+				{Date: "2024-06-01", Removed: true},
+				{Date: "2025-03-14"},
+				{Date: "2025-04-01", Removed: true},
+			},
+			want: []interval{
+				{Removed: str("2024-06-01")},
+				{Added: str("2025-03-14"), Removed: str("2025-04-01")},
+			},
+		},
+		{
+			name: "duplicate transitions",
+			events: []lifecycleEvent{
+				{Date: "2024-01-01"},
+				{Date: "2024-02-01"},
+				{Date: "2024-06-01", Removed: true},
+				{Date: "2024-07-01", Removed: true},
+			},
+			want: []interval{
+				{Added: str("2024-01-01"), Removed: str("2024-06-01")},
+			},
+		},
+		{
+			name:       "registered before tracking started",
+			registered: true,
+			want:       []interval{{}},
+		},
+		{
+			name: "re-registered without an addition",
+			events: []lifecycleEvent{
+				{Date: "2024-01-01"},
+				{Date: "2024-06-01", Removed: true},
+			},
+			registered: true,
+			want: []interval{
+				{Added: str("2024-01-01"), Removed: str("2024-06-01")},
+				{Added: str("2025-05-01")},
+			},
+			inconsistent: true,
+		},
+		{
+			name:         "registered after a removal before tracking started",
+			events:       []lifecycleEvent{{Date: "2024-06-01", Removed: true}},
+			registered:   true,
+			want:         []interval{{Removed: str("2024-06-01")}, {Added: str("2025-05-01")}},
+			inconsistent: true,
+		},
+		{
+			name:         "open interval but not registered",
+			events:       []lifecycleEvent{{Date: "2025-03-14"}},
+			want:         []interval{{Added: str("2025-03-14")}},
+			inconsistent: true,
+		},
+	}
+
+	deref := func(s *string) string {
+		if s == nil {
+			return "<nil>"
+		}
+		return *s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, consistent := buildIntervals(tt.events, tt.registered, "2025-05-01")
+			if consistent == tt.inconsistent {
+				t.Errorf("buildIntervals() consistent = %v, want %v", consistent, !tt.inconsistent)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("buildIntervals() returned %d intervals, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if deref(got[i].Added) != deref(tt.want[i].Added) || deref(got[i].Removed) != deref(tt.want[i].Removed) {
+					t.Errorf("buildIntervals()[%d] = {%s %s}, want {%s %s}", i,
+						deref(got[i].Added), deref(got[i].Removed), deref(tt.want[i].Added), deref(tt.want[i].Removed))
+				}
+			}
+		})
+	}
+}
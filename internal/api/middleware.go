@@ -1,13 +1,173 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/metrics"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Middleware(next http.HandlerFunc) http.HandlerFunc {
+var tracer = otel.Tracer("go-axfr-backend/internal/api")
+
+// failSpan marks span as failed with err.
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// requestIDHeader carries the request ID in both directions; a sane incoming value is kept so IDs
+// can be correlated with an upstream proxy.
+const requestIDHeader = "X-Request-ID"
+
+// requestID returns the ID RequestID assigned to r, or "" outside of it.
+func requestID(r *http.Request) string {
+	return logging.RequestID(r.Context())
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID keeps a sane incoming X-Request-ID or generates one, echoes it in the response and
+// stores it in the request context, where logging picks it up.
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	}
+}
+
+// statusRecorder remembers the status code and counts the body bytes written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (rec *statusRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Middleware wraps the JSON API handlers: it assigns the request ID, traces the request,
+// authenticates its API key, applies the rate limit, records its metrics and writes the access log line.
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return RequestID(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 		http.MaxBytesReader(w, r.Body, 1048576)
 		w.Header().Set("content-type", "application/json")
-		next(w, r)
-	}
+
+		// The server span continues a trace started upstream when the request carries traceparent.
+		// r.Pattern is the ServeMux pattern, e.g. "/dates/", which keeps span names and metric
+		// labels bounded.
+		spanCtx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		spanCtx, span := tracer.Start(spanCtx, r.Method+" "+r.Pattern,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(r.Pattern),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("request.id", requestID(r)),
+			))
+		defer span.End()
+		r = r.WithContext(spanCtx)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		// Deferred so a streamed response aborted with http.ErrAbortHandler is still recorded.
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			duration := time.Since(start)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			metrics.HTTPRequests.WithLabelValues(r.Pattern, r.Method, strconv.Itoa(status)).Inc()
+			metrics.HTTPDuration.WithLabelValues(r.Pattern, r.Method).Observe(duration.Seconds())
+
+			var keyName string
+			if key := apiKey(r); key != nil {
+				keyName = key.Name
+			}
+			slog.InfoContext(r.Context(), "request",
+				slog.String("method", r.Method),
+				slog.String("route", r.Pattern),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", rec.bytes),
+				slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+				slog.String("cache", w.Header().Get("X-Cache")),
+				slog.String("api_key", keyName),
+			)
+		}()
+
+		// Quotas are charged last so requests the rate limiter turns away don't use them up.
+		r, err := authenticate(r)
+		if err == nil {
+			err = rateLimit(rec, r)
+		}
+		if err == nil {
+			err = chargeQuota(r)
+		}
+		if err != nil {
+			writeError(rec, r, err)
+		} else {
+			next(rec, r)
+		}
+	})
 }
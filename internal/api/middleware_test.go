@@ -1,10 +1,23 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/metrics"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestMiddleware(t *testing.T) {
@@ -92,3 +105,112 @@ func TestMiddlewareSetsContentType(t *testing.T) {
 		t.Errorf("Middleware() did not set content-type header correctly")
 	}
 }
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var seen string
+	wrappedHandler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Request-ID", "upstream-1")
+	rr := httptest.NewRecorder()
+	wrappedHandler(rr, req)
+	if seen != "upstream-1" || rr.Header().Get("X-Request-ID") != "upstream-1" {
+		t.Errorf("request ID = %q, header %q, want the incoming upstream-1", seen, rr.Header().Get("X-Request-ID"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rr = httptest.NewRecorder()
+	wrappedHandler(rr, req)
+	if seen == "" || seen == "bad id\n" || rr.Header().Get("X-Request-ID") != seen {
+		t.Errorf("request ID = %q, want a generated ID echoed in the header", seen)
+	}
+}
+
+func TestMiddlewareMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics-test/{tld}", Middleware(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, notFound("unknown_tld", "unknown TLD"))
+	}))
+
+	counter := metrics.HTTPRequests.WithLabelValues("/metrics-test/{tld}", http.MethodGet, "404")
+	before := testutil.ToFloat64(counter)
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/zz", nil))
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("requests counted for the route pattern with status 404 = %v, want 1", got)
+	}
+}
+
+func TestMiddlewareTracesCache(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	swap[cache.Cache](t, &responseCache, cache.Nop{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trace-test/", Middleware(func(w http.ResponseWriter, r *http.Request) {
+		serveCached(w, r, "trace:se", ShortTTL, nil, func(context.Context) ([]int, error) {
+			return []int{}, nil
+		})
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/trace-test/se", nil))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	server, ok := spans["GET /trace-test/"]
+	if !ok {
+		t.Fatalf("spans = %v, want a server span named after the route pattern", spans)
+	}
+	for child, parent := range map[string]string{
+		"cache.getOrSet": "GET /trace-test/",
+		"cache.get":      "cache.getOrSet",
+		"cache.generate": "cache.getOrSet",
+	} {
+		s, ok := spans[child]
+		if !ok {
+			t.Errorf("missing span %s", child)
+			continue
+		}
+		if s.Parent().SpanID() != spans[parent].SpanContext().SpanID() || s.SpanContext().TraceID() != server.SpanContext().TraceID() {
+			t.Errorf("span %s is not a child of %s", child, parent)
+		}
+	}
+}
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo, logging.FormatJSON))
+	swap[cache.Cache](t, &responseCache, cache.Nop{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/log-test/", Middleware(func(w http.ResponseWriter, r *http.Request) {
+		serveCached(w, r, "log:se", ShortTTL, nil, func(context.Context) ([]int, error) {
+			return []int{1, 2}, nil
+		})
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/log-test/se", nil)
+	req.Header.Set("X-Request-ID", "req-log")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+		Bytes     int    `json:"bytes"`
+		Cache     string `json:"cache"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log output %q is not one JSON record: %v", buf.String(), err)
+	}
+	if entry.Msg != "request" || entry.RequestID != "req-log" || entry.Route != "/log-test/" ||
+		entry.Status != http.StatusOK || entry.Bytes != 5 || entry.Cache != cacheMiss {
+		t.Errorf("access log = %+v", entry)
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 1000
+)
+
+var errInvalidCursor = badRequest("invalid_cursor", "invalid cursor")
+
+// cursor is the position of a keyset page: the last seen (date, domain) pair. Domain is empty for
+// the dates listing. Reverse cursors page towards the start of the listing.
+type cursor struct {
+	Date    int    `json:"d"`
+	Domain  string `json:"k,omitempty"`
+	Reverse bool   `json:"r,omitempty"`
+}
+
+// encode returns the opaque token clients send back in ?cursor=.
+func (c cursor) encode() string {
+	j, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(j)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+// keysetPage is the response of a cursor-paginated listing.
+type keysetPage[T any] struct {
+	Items []T     `json:"items"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+	// Partial is set when a scan limit cut the page short; the cursor continues the scan.
+	Partial bool `json:"partial,omitempty"`
+}
+
+func (p keysetPage[T]) csvRecords() any {
+	return p.Items
+}
+
+func (p keysetPage[T]) cursors() (next *string, prev *string) {
+	return p.Next, p.Prev
+}
+
+// cursorLinker is implemented by keyset pages. Formats other than JSON have no place for the
+// cursors in the body and send them as a Link header instead, see setPageLinks.
+type cursorLinker interface {
+	cursors() (next *string, prev *string)
+}
+
+// setPageLinks adds a Link header relation for each cursor of page: the request URL with ?cursor=
+// replaced, relative to the request so it works behind any host.
+func setPageLinks(w http.ResponseWriter, r *http.Request, page cursorLinker) {
+	next, prev := page.cursors()
+	for _, link := range []struct {
+		rel   string
+		token *string
+	}{{"next", next}, {"prev", prev}} {
+		if link.token == nil {
+			continue
+		}
+		u := *r.URL
+		query := u.Query()
+		query.Set("cursor", *link.token)
+		u.RawQuery = query.Encode()
+		w.Header().Add("Link", "<"+u.RequestURI()+">; rel=\""+link.rel+"\"")
+	}
+}
+
+// buildKeysetPage turns up to limit+1 rows fetched in cursor direction into a page in listing order.
+// The extra row only signals that more rows exist in that direction.
+func buildKeysetPage[T any](items []T, limit int, cur *cursor, keyOf func(T) cursor) keysetPage[T] {
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	reverse := cur != nil && cur.Reverse
+	if reverse {
+		slices.Reverse(items)
+	}
+
+	page := keysetPage[T]{Items: items}
+	if len(items) == 0 {
+		return page
+	}
+
+	first := keyOf(items[0])
+	first.Reverse = true
+	last := keyOf(items[len(items)-1])
+	last.Reverse = false
+
+	// Paging backwards we came from the following page, paging forwards from the preceding one.
+	if reverse || hasMore {
+		next := last.encode()
+		page.Next = &next
+	}
+	if (reverse && hasMore) || (!reverse && cur != nil) {
+		prev := first.encode()
+		page.Prev = &prev
+	}
+	return page
+}
+
+// parseKeysetParams reads ?cursor= and ?limit= from a request.
+func parseKeysetParams(r *http.Request) (*cursor, int, error) {
+	limit := defaultPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, 0, badRequest("invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+		limit = n
+	}
+
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, limit, nil
+	}
+	c, err := decodeCursor(token)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &c, limit, nil
+}
+
+func keysetCacheKey(prefix string, cur *cursor, limit int) string {
+	var keyBuilder strings.Builder
+	keyBuilder.WriteString(prefix)
+	keyBuilder.WriteString(":cursor:")
+	if cur != nil {
+		keyBuilder.WriteString(cur.encode())
+	}
+	keyBuilder.WriteString(":limit:")
+	keyBuilder.WriteString(strconv.Itoa(limit))
+	return keyBuilder.String()
+}
+
+func sendDatesKeyset(ctx context.Context, diffdb config.Database, cur *cursor, limit int) (keysetPage[dateAmounts], error) {
+	defer observeQuery(ctx, "dates", diffdb.ID+" cursor", time.Now())
+
+	db, err := dbConn(ctx, diffdb)
+	if err != nil {
+		return keysetPage[dateAmounts]{}, errDatabase(err)
+	}
+
+	query := "SELECT date, COALESCE(amount, 0), COALESCE(removed, 0) FROM dates"
+	var args []interface{}
+	switch {
+	case cur == nil:
+		query += " ORDER BY date DESC LIMIT ?"
+	case cur.Reverse:
+		query += " WHERE date > ? ORDER BY date ASC LIMIT ?"
+		args = append(args, cur.Date)
+	default:
+		query += " WHERE date < ? ORDER BY date DESC LIMIT ?"
+		args = append(args, cur.Date)
+	}
+	args = append(args, limit+1)
+
+	rows, err := database.Query(ctx, db, query, args...)
+	if err != nil {
+		return keysetPage[dateAmounts]{}, errQuery(err)
+	}
+	defer rows.Close()
+
+	arr := make([]dateAmounts, 0, limit+1)
+	for rows.Next() {
+		var da dateAmounts
+		if err := rows.Scan(&da.Date, &da.Added, &da.Removed); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+			continue
+		}
+		da.Amount = da.Added
+		arr = append(arr, da)
+	}
+	if err := rows.Err(); err != nil {
+		return keysetPage[dateAmounts]{}, errQuery(err)
+	}
+
+	return buildKeysetPage(arr, limit, cur, func(da dateAmounts) cursor {
+		return cursor{Date: da.Date}
+	}), nil
+}
+
+func sendRowsKeyset(ctx context.Context, diffdb config.Database, table string, date int, cur *cursor, limit int) (keysetPage[domainRow], error) {
+	defer observeQuery(ctx, "day_listing", fmt.Sprintf("%s %d cursor", table, date), time.Now())
+
+	db, err := dbConn(ctx, diffdb)
+	if err != nil {
+		return keysetPage[domainRow]{}, errDatabase(err)
+	}
+
+	query := "SELECT domain FROM " + table + " JOIN dates ON " + table + ".dategrp = dates.id WHERE date = ?"
+	args := []interface{}{date}
+	switch {
+	case cur == nil:
+		query += " ORDER BY domain ASC LIMIT ?"
+	case cur.Reverse:
+		query += " AND domain < ? ORDER BY domain DESC LIMIT ?"
+		args = append(args, cur.Domain)
+	default:
+		query += " AND domain > ? ORDER BY domain ASC LIMIT ?"
+		args = append(args, cur.Domain)
+	}
+	args = append(args, limit+1)
+
+	rows, err := database.Query(ctx, db, query, args...)
+	if err != nil {
+		return keysetPage[domainRow]{}, errQuery(err)
+	}
+	defer rows.Close()
+
+	arr := make([]domainRow, 0, limit+1)
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+			continue
+		}
+		arr = append(arr, domainRow{Domain: domain})
+	}
+	if err := rows.Err(); err != nil {
+		return keysetPage[domainRow]{}, errQuery(err)
+	}
+
+	return buildKeysetPage(arr, limit, cur, func(row domainRow) cursor {
+		return cursor{Date: date, Domain: row.Domain}
+	}), nil
+}
+
+func serveDiffDatesCursor(w http.ResponseWriter, r *http.Request, tld string) {
+	db, err := getDiffDatabase(tld, config.EndpointDates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cur, limit, err := parseKeysetParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cacheKey := keysetCacheKey(tld+"dates", cur, limit)
+
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags(tld, cache.DatasetDiff), func(ctx context.Context) (keysetPage[dateAmounts], error) {
+		return sendDatesKeyset(ctx, db, cur, limit)
+	})
+}
+
+func serveDayListingCursor(w http.ResponseWriter, r *http.Request, tld string, endpoint string, kind string, table string, dateParam string) {
+	db, err := getDiffDatabase(tld, endpoint)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	date, err := strconv.Atoi(dateParam)
+	if err != nil {
+		writeError(w, r, badRequest("invalid_date", "invalid date number"))
+		return
+	}
+
+	cur, limit, err := parseKeysetParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if cur != nil && cur.Date != date {
+		writeError(w, r, badRequest("invalid_cursor", "cursor does not belong to this date"))
+		return
+	}
+
+	cacheKey := keysetCacheKey(tld+kind+":date:"+strconv.Itoa(date), cur, limit)
+
+	serveCached(w, r, cacheKey, MediumTTL, cache.Tags(tld, cache.DatasetDiff), func(ctx context.Context) (keysetPage[domainRow], error) {
+		return sendRowsKeyset(ctx, db, table, date, cur, limit)
+	})
+}
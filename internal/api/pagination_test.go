@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"go-axfr-backend/internal/cache"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := cursor{Date: 20250314, Domain: "xn--hemstd-fua.nu", Reverse: true}
+
+	got, err := decodeCursor(want.encode())
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("decodeCursor() = %+v, want %+v", got, want)
+	}
+
+	for _, token := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeCursor(token); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded", token)
+		}
+	}
+}
+
+func TestBuildKeysetPage(t *testing.T) {
+	keyOf := func(s string) cursor { return cursor{Date: 1, Domain: s} }
+	token := func(domain string, reverse bool) string {
+		return cursor{Date: 1, Domain: domain, Reverse: reverse}.encode()
+	}
+
+	tests := []struct {
+		name      string
+		items     []string
+		cur       *cursor
+		wantItems []string
+		wantNext  string
+		wantPrev  string
+	}{
+		{
+			name:      "first page with more",
+			items:     []string{"a", "b", "c"},
+			wantItems: []string{"a", "b"},
+			wantNext:  token("b", false),
+		},
+		{
+			name:      "only page",
+			items:     []string{"a"},
+			wantItems: []string{"a"},
+		},
+		{
+			name:      "forward page with more",
+			items:     []string{"c", "d", "e"},
+			cur:       &cursor{Date: 1, Domain: "b"},
+			wantItems: []string{"c", "d"},
+			wantNext:  token("d", false),
+			wantPrev:  token("c", true),
+		},
+		{
+			name:      "last forward page",
+			items:     []string{"e"},
+			cur:       &cursor{Date: 1, Domain: "d"},
+			wantItems: []string{"e"},
+			wantPrev:  token("e", true),
+		},
+		{
+			name:      "reverse page with more",
+			items:     []string{"d", "c", "b"},
+			cur:       &cursor{Date: 1, Domain: "e", Reverse: true},
+			wantItems: []string{"c", "d"},
+			wantNext:  token("d", false),
+			wantPrev:  token("c", true),
+		},
+		{
+			name:      "reverse page reaching the start",
+			items:     []string{"b", "a"},
+			cur:       &cursor{Date: 1, Domain: "c", Reverse: true},
+			wantItems: []string{"a", "b"},
+			wantNext:  token("b", false),
+		},
+		{
+			name:      "empty page",
+			cur:       &cursor{Date: 1, Domain: "z"},
+			wantItems: nil,
+		},
+	}
+
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := buildKeysetPage(tt.items, 2, tt.cur, keyOf)
+			if len(page.Items) != len(tt.wantItems) {
+				t.Fatalf("buildKeysetPage() items = %v, want %v", page.Items, tt.wantItems)
+			}
+			for i := range page.Items {
+				if page.Items[i] != tt.wantItems[i] {
+					t.Errorf("buildKeysetPage() items = %v, want %v", page.Items, tt.wantItems)
+					break
+				}
+			}
+			if got := deref(page.Next); got != tt.wantNext {
+				t.Errorf("buildKeysetPage() next = %q, want %q", got, tt.wantNext)
+			}
+			if got := deref(page.Prev); got != tt.wantPrev {
+				t.Errorf("buildKeysetPage() prev = %q, want %q", got, tt.wantPrev)
+			}
+		})
+	}
+}
+
+func TestParseKeysetParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit int
+		wantCur   bool
+		wantErr   bool
+	}{
+		{name: "defaults", query: "", wantLimit: defaultPageLimit},
+		{name: "custom limit", query: "?limit=500", wantLimit: 500},
+		{name: "limit too large", query: "?limit=1001", wantErr: true},
+		{name: "limit zero", query: "?limit=0", wantErr: true},
+		{name: "cursor", query: "?cursor=" + cursor{Date: 20250314}.encode(), wantLimit: defaultPageLimit, wantCur: true},
+		{name: "bad cursor", query: "?cursor=@@@", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/dates/se"+tt.query, nil)
+			cur, limit, err := parseKeysetParams(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeysetParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if limit != tt.wantLimit {
+				t.Errorf("parseKeysetParams() limit = %d, want %d", limit, tt.wantLimit)
+			}
+			if (cur != nil) != tt.wantCur {
+				t.Errorf("parseKeysetParams() cursor = %v, want present %v", cur, tt.wantCur)
+			}
+		})
+	}
+}
+
+func TestCSVPagesFollowLinks(t *testing.T) {
+	swap[cache.Cache](t, &responseCache, cache.NewMemory(0, 0))
+
+	domains := []string{"a.se", "b.se", "c.se", "d.se", "e.se"}
+	listing := func(w http.ResponseWriter, r *http.Request) {
+		cur, limit, err := parseKeysetParams(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		serveCached(w, r, keysetCacheKey("test", cur, limit), ShortTTL, nil, func(context.Context) (keysetPage[domainRow], error) {
+			// limit+1 rows in cursor direction, as the SQL listings fetch them.
+			var rows []domainRow
+			for _, domain := range domains {
+				if cur == nil || (!cur.Reverse && domain > cur.Domain) || (cur.Reverse && domain < cur.Domain) {
+					rows = append(rows, domainRow{Domain: domain})
+				}
+			}
+			if cur != nil && cur.Reverse {
+				slices.Reverse(rows)
+			}
+			rows = rows[:min(len(rows), limit+1)]
+			return buildKeysetPage(rows, limit, cur, func(row domainRow) cursor { return cursor{Domain: row.Domain} }), nil
+		})
+	}
+
+	linkRe := regexp.MustCompile(`^<([^>]+)>; rel="(next|prev)"$`)
+	get := func(target string) (body []string, links map[string]string) {
+		rr := httptest.NewRecorder()
+		listing(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+			t.Fatalf("GET %s = %d %s", target, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		links = make(map[string]string)
+		for _, link := range rr.Header().Values("Link") {
+			m := linkRe.FindStringSubmatch(link)
+			if m == nil {
+				t.Fatalf("GET %s: malformed Link %q", target, link)
+			}
+			links[m[2]] = m[1]
+		}
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		return lines[1:], links
+	}
+
+	// Twice: the second walk is served from the cache and must carry the same links.
+	for range 2 {
+		var seen []string
+		var last string
+		for target := "/list/se?format=csv&limit=2"; target != ""; {
+			rows, links := get(target)
+			seen = append(seen, rows...)
+			last, target = target, links["next"]
+		}
+		if !slices.Equal(seen, domains) {
+			t.Errorf("following next links gave %v, want %v", seen, domains)
+		}
+
+		_, links := get(last)
+		if rows, _ := get(links["prev"]); !slices.Equal(rows, []string{"c.se", "d.se"}) {
+			t.Errorf("prev of the last page = %v, want c.se and d.se", rows)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/metrics"
+	"go-axfr-backend/internal/ratelimit"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+)
+
+// rateLimits holds the limiter and per-route limits; nil when no route is limited.
+var rateLimits *rateLimiting
+
+type rateLimiting struct {
+	limiter ratelimit.Limiter
+	trusted []netip.Prefix
+	def     config.RouteLimit
+	routes  map[string]config.RouteLimit
+}
+
+// InitRateLimit sets up the rate limiter selected in the config. Redis buckets fall back to
+// per-node memory buckets while Redis is unreachable.
+func InitRateLimit() {
+	cfg := tldRegistry.Config()
+	limits := cfg.RateLimit
+	if !limitsAnything(limits) {
+		return
+	}
+
+	trusted, err := ratelimit.ParsePrefixes(limits.TrustedProxies)
+	if err != nil {
+		slog.Error("invalid trusted proxies", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var limiter ratelimit.Limiter = ratelimit.NewMemory()
+	if limits.Backend == config.RateLimitRedis {
+		limiter = &ratelimit.Fallback{Primary: ratelimit.NewRedis(cfg.Cache.Redis), Secondary: limiter}
+	}
+
+	rateLimits = &rateLimiting{limiter: limiter, trusted: trusted, def: limits.Default, routes: limits.Routes}
+	slog.Info("rate limiting enabled", slog.String("backend", limits.Backend), slog.Int("routes", len(limits.Routes)))
+}
+
+// CloseRateLimit releases the rate limiter, for use on server shutdown.
+func CloseRateLimit() error {
+	if rateLimits == nil {
+		return nil
+	}
+	return rateLimits.limiter.Close()
+}
+
+func limitsAnything(limits config.RateLimit) bool {
+	enabled := func(l config.RouteLimit) bool { return l.PerIP.Rate > 0 || l.PerKey.Rate > 0 }
+	if enabled(limits.Default) {
+		return true
+	}
+	for _, l := range limits.Routes {
+		if enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimit charges r against its bucket, per API key for keyed requests and per client IP
+// otherwise, and sets the RateLimit headers. It returns the error to answer r with once the bucket
+// is empty. A failing limiter lets requests through.
+func rateLimit(w http.ResponseWriter, r *http.Request) error {
+	if rateLimits == nil {
+		return nil
+	}
+	route, ok := rateLimits.routes[r.Pattern]
+	if !ok {
+		route = rateLimits.def
+	}
+
+	limit, bucket, subject := route.PerIP, "ip", ""
+	if key := apiKey(r); key != nil {
+		limit, bucket, subject = route.PerKey, "key", key.Name
+	} else {
+		subject = ratelimit.Subject(ratelimit.ClientIP(r, rateLimits.trusted))
+	}
+	l := ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}
+	if !l.Enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	res, err := rateLimits.limiter.Allow(r.Context(), "ratelimit:"+r.Pattern+":"+bucket+":"+subject, l, now)
+	if err != nil {
+		slog.WarnContext(r.Context(), "rate limiter failed, request not limited", logging.Err(err))
+		return nil
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(l.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Sub(now).Round(time.Second).Seconds())))
+	h.Set("RateLimit-Policy", l.Policy())
+	if res.Allowed {
+		return nil
+	}
+	metrics.RateLimited.WithLabelValues(r.Pattern, bucket).Inc()
+	return &apiError{status: http.StatusTooManyRequests, code: "rate_limited", message: "too many requests, slow down", retryAt: res.RetryAt}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"go-axfr-backend/internal/auth"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	os.WriteFile(path, []byte("keys:\n  - {name: partner, key_sha256: "+auth.Hash("partner-key")+", enabled: true, daily_quota: 2}\n"), 0o600)
+	store, err := auth.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(t, &authenticator, &auth.Authenticator{Store: store, Quotas: auth.NewMemoryQuotas()})
+	swap(t, &rateLimits, &rateLimiting{
+		limiter: ratelimit.NewMemory(),
+		trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		routes: map[string]config.RouteLimit{
+			"/limited/": {PerIP: config.Limit{Rate: 0.01, Burst: 2}, PerKey: config.Limit{Rate: 0.01, Burst: 1}},
+		},
+	})
+
+	mux := http.NewServeMux()
+	ok := Middleware(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) })
+	mux.HandleFunc("/limited/", ok)
+	mux.HandleFunc("/open/", ok)
+
+	send := func(path string, remote string, xff string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		if key != "" {
+			req.Header.Set(auth.Header, key)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("/limited/se", "198.51.100.7:1000", "", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != "1" ||
+		rr.Header().Get("RateLimit-Policy") != "2;w=200" {
+		t.Errorf("first request = %d, headers %v", rr.Code, rr.Header())
+	}
+	send("/limited/se", "198.51.100.7:1000", "", "")
+	rr = send("/limited/se", "198.51.100.7:1000", "", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "100" || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("third request = %d, headers %v, want 429 retrying in 100s", rr.Code, rr.Header())
+	}
+
+	// The same client behind a trusted proxy shares the bucket; a spoofed header from elsewhere does not.
+	if rr := send("/limited/se", "10.0.0.1:1000", "198.51.100.7", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("proxied request = %d, want 429", rr.Code)
+	}
+	if rr := send("/limited/se", "203.0.113.5:1000", "198.51.100.7", ""); rr.Code != http.StatusOK {
+		t.Errorf("spoofed request = %d, want 200 from its own bucket", rr.Code)
+	}
+
+	// Keyed requests draw from the key's bucket wherever they come from.
+	if rr := send("/limited/se", "198.51.100.7:1000", "", "partner-key"); rr.Code != http.StatusOK {
+		t.Errorf("keyed request = %d, want 200", rr.Code)
+	}
+	if rr := send("/limited/se", "203.0.113.6:1000", "", "partner-key"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("second keyed request = %d, want 429", rr.Code)
+	}
+
+	// The rate-limited request did not use up quota: the daily quota of 2 still has one left.
+	if rr := send("/open/se", "203.0.113.6:1000", "", "partner-key"); rr.Code != http.StatusOK {
+		t.Errorf("keyed request after a 429 = %d, want 200 within quota", rr.Code)
+	}
+	if rr := send("/open/se", "203.0.113.6:1000", "", "partner-key"); rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "quota_exceeded") {
+		t.Errorf("keyed request over quota = %d %s, want 429 quota_exceeded", rr.Code, rr.Body)
+	}
+
+	if rr := send("/open/se", "198.51.100.7:1000", "", ""); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("unlimited route = %d, headers %v", rr.Code, rr.Header())
+	}
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Response formats, chosen per request by negotiateFormat.
+const (
+	formatJSON    = "json"
+	formatCSV     = "csv"
+	formatMsgPack = "msgpack"
+	formatCBOR    = "cbor"
+)
+
+// responseFormat is an encoding of handler values. Formats are listed in order of preference for
+// requests that accept several equally.
+type responseFormat struct {
+	name        string
+	contentType string
+	// mediaTypes are the Accept media types selecting the format.
+	mediaTypes []string
+	encode     func(v any) ([]byte, error)
+}
+
+var cborEncoding, _ = cbor.EncOptions{
+	Sort:    cbor.SortCoreDeterministic,
+	Time:    cbor.TimeRFC3339Nano,
+	TimeTag: cbor.EncTagRequired,
+}.EncMode()
+
+var responseFormats = []responseFormat{
+	{formatJSON, "application/json", []string{"application/json"}, json.Marshal},
+	{formatCSV, "text/csv; charset=utf-8", []string{"text/csv"}, encodeCSV},
+	{formatMsgPack, "application/msgpack", []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}, encodeMsgPack},
+	{formatCBOR, "application/cbor", []string{"application/cbor"}, cborEncoding.Marshal},
+}
+
+func lookupFormat(name string) (responseFormat, bool) {
+	i := slices.IndexFunc(responseFormats, func(f responseFormat) bool { return f.name == name })
+	if i < 0 {
+		return responseFormat{}, false
+	}
+	return responseFormats[i], true
+}
+
+// negotiateFormat picks the response format from ?format= or, without it, from the Accept header.
+// Requests without either get JSON.
+func negotiateFormat(r *http.Request) (responseFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, ok := lookupFormat(name)
+		if !ok {
+			return f, badRequest("invalid_format", "format must be json, csv, msgpack or cbor")
+		}
+		return f, nil
+	}
+
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return responseFormats[0], nil
+	}
+	ranges := parseAccept(strings.Join(accept, ","))
+	best, bestQ := -1, 0.0
+	for i, f := range responseFormats {
+		if q := acceptQuality(ranges, f.mediaTypes); q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	if best < 0 {
+		return responseFormat{}, &apiError{status: http.StatusNotAcceptable, code: "not_acceptable", message: "acceptable formats are application/json, text/csv, application/msgpack and application/cbor"}
+	}
+	return responseFormats[best], nil
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, item := range strings.Split(header, ",") {
+		mediaType, params, _ := strings.Cut(item, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality the most specific matching range gives any of mediaTypes.
+func acceptQuality(ranges []mediaRange, mediaTypes []string) float64 {
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		for _, mediaType := range mediaTypes {
+			major, _, _ := strings.Cut(mediaType, "/")
+			s := -1
+			switch mr.mediaType {
+			case mediaType:
+				s = 2
+			case major + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			}
+			if s >= 0 && (s > specificity || (s == specificity && mr.q > q)) {
+				q, specificity = mr.q, s
+			}
+		}
+	}
+	return q
+}
+
+// writeValue negotiates the format of an uncached response and writes v in it.
+func writeValue(w http.ResponseWriter, r *http.Request, v any) {
+	f, err := negotiateFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	data, err := f.encode(v)
+	if err != nil {
+		writeError(w, r, errEncode(err))
+		return
+	}
+	setFormatHeaders(w, f)
+	w.Write(data)
+}
+
+func setFormatHeaders(w http.ResponseWriter, f responseFormat) {
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Add("Vary", "Accept")
+}
+
+func encodeMsgPack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// Field names and omitempty follow the json tags, so every format carries the same keys.
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvRecorder is implemented by response envelopes whose CSV form is only their list of records,
+// such as keyset pages, whose cursors are sent as a Link header instead.
+type csvRecorder interface {
+	csvRecords() any
+}
+
+// encodeCSV writes a list of structs as one row per element with a header of their json field
+// names; a single struct is a one-row table and a map gets a leading key column. Nested lists and
+// objects are written as JSON inside their cell.
+func encodeCSV(v any) ([]byte, error) {
+	if rec, ok := v.(csvRecorder); ok {
+		v = rec.csvRecords()
+	}
+
+	var keys []string
+	var records []reflect.Value
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			records = append(records, rv.Index(i))
+		}
+	case reflect.Map:
+		byKey := make(map[string]reflect.Value, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			key := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, key)
+			byKey[key] = iter.Value()
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			records = append(records, byKey[key])
+		}
+		if keys == nil {
+			keys = []string{}
+		}
+	default:
+		records = []reflect.Value{rv}
+	}
+
+	// The columns come from the element type, so empty lists still get their header.
+	elem := rv.Type()
+	if k := elem.Kind(); k == reflect.Slice || k == reflect.Array || k == reflect.Map {
+		elem = elem.Elem()
+	}
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	var header []string
+	var fields [][]int
+	if elem.Kind() == reflect.Struct && elem != reflect.TypeFor[time.Time]() {
+		for _, f := range reflect.VisibleFields(elem) {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || f.Anonymous || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			header = append(header, name)
+			fields = append(fields, f.Index)
+		}
+	} else {
+		header = []string{"value"}
+	}
+	if keys != nil {
+		header = append([]string{"key"}, header...)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for i, record := range records {
+		var row []string
+		if keys != nil {
+			row = append(row, keys[i])
+		}
+		record = reflect.Indirect(record)
+		if fields == nil {
+			cell, err := csvCell(record)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, cell)
+		}
+		for _, index := range fields {
+			var field reflect.Value
+			if record.IsValid() {
+				field, _ = record.FieldByIndexErr(index)
+			}
+			cell, err := csvCell(field)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, cell)
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvCell formats one value; nil pointers and missing values are empty cells.
+func csvCell(v reflect.Value) (string, error) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	j, err := json.Marshal(v.Interface())
+	return string(j), err
+}
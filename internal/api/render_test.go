@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantFormat string
+		wantStatus int
+	}{
+		{"default", "", "", formatJSON, 0},
+		{"any", "", "*/*", formatJSON, 0},
+		{"csv", "", "text/csv", formatCSV, 0},
+		{"msgpack alias", "", "application/x-msgpack", formatMsgPack, 0},
+		{"q values", "", "application/json;q=0.5, application/cbor", formatCBOR, 0},
+		{"specific range wins", "", "text/*;q=0.9, text/csv;q=0.1, application/*;q=0.5", formatJSON, 0},
+		{"browser", "", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatJSON, 0},
+		{"query beats accept", "format=msgpack", "text/csv", formatMsgPack, 0},
+		{"unknown query", "format=xml", "", "", http.StatusBadRequest},
+		{"not acceptable", "", "text/html", "", http.StatusNotAcceptable},
+		{"refused", "", "application/json;q=0", "", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/dates/se?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			f, err := negotiateFormat(req)
+			var apiErr *apiError
+			if tt.wantStatus != 0 {
+				if !errors.As(err, &apiErr) || apiErr.status != tt.wantStatus {
+					t.Fatalf("negotiateFormat() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil || f.name != tt.wantFormat {
+				t.Errorf("negotiateFormat() = %q, %v, want %q", f.name, err, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	next := "abc"
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"rows", []domainRow{{"a.se"}, {"b,c.se"}}, "domain\na.se\n\"b,c.se\"\n"},
+		{"empty rows", []dateAmounts{}, "date,amount,added,removed\n"},
+		{"keyset page drops cursors", keysetPage[domainRow]{Items: []domainRow{{"a.se"}}, Next: &next}, "domain\na.se\n"},
+		{"struct", firstAppearance{}, "earliest_date\n\n"},
+		{"map", map[string]int{"b": 2, "a": 1}, "key,value\na,1\nb,2\n"},
+		{"nested", []struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}{{"x", []string{"y"}}}, "name,tags\nx,\"[\"\"y\"\"]\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeCSV(tt.value)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("encodeCSV() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryFormatsUseJSONNames(t *testing.T) {
+	page := keysetPage[dateAmounts]{Items: []dateAmounts{{Date: 20240101, Amount: 3, Added: 3}}}
+	want := map[string]any{"items": []any{map[string]any{"date": 20240101, "amount": 3, "added": 3, "removed": 0}}, "next": nil, "prev": nil}
+
+	data, err := encodeMsgPack(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromMsgPack map[string]any
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.UseLooseInterfaceDecoding(true)
+	if err := dec.Decode(&fromMsgPack); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := lookupFormat(formatCBOR)
+	data, err = f.encode(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromCBOR map[string]any
+	if err := cbor.Unmarshal(data, &fromCBOR); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]map[string]any{"msgpack": fromMsgPack, "cbor": fromCBOR} {
+		// Sprint prints maps sorted and integers alike whatever their width.
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -1,22 +1,55 @@
 package api
 
 import (
+	"go-axfr-backend/internal/auth"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/metrics"
 	"net/http"
+	"sync"
 )
 
-func SetupRoutes() *http.ServeMux {
+// registerPoolMetrics adds the connection pool collector to the metrics registry once, however
+// often the admin routes are set up.
+var registerPoolMetrics = sync.OnceFunc(func() {
+	metrics.RegisterPools(func() map[string]database.Stats { return dbPoolStats() })
+})
+
+// SetupRoutes returns the public API routes behind the CORS policy of the registry.
+func SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/ready", readyness)
-	mux.HandleFunc("/status", liveness)
-	mux.HandleFunc("/se/", Middleware(sendSEDates))
-	mux.HandleFunc("/nu/", Middleware(sendNUDates))
-	mux.HandleFunc("/sedomains/", Middleware(sendSERows))
-	mux.HandleFunc("/nudomains/", Middleware(sendNURows))
+	mux.HandleFunc("/ready", RequestID(readyness))
+	mux.HandleFunc("/status", RequestID(liveness))
+	mux.HandleFunc("/dates/", Middleware(diffDates))
+	mux.HandleFunc("/domains/", Middleware(diffRows))
+	mux.HandleFunc("/removed/", Middleware(diffRemovedRows))
+	mux.HandleFunc("/se/", Middleware(legacyDiffDates("se")))
+	mux.HandleFunc("/nu/", Middleware(legacyDiffDates("nu")))
+	mux.HandleFunc("/sedomains/", Middleware(legacyDiffRows("se")))
+	mux.HandleFunc("/nudomains/", Middleware(legacyDiffRows("nu")))
+	mux.HandleFunc("/history/", Middleware(domainHistory))
 	mux.HandleFunc("/search/", Middleware(domainSearch))
 	mux.HandleFunc("/stats/", Middleware(domainStats))
 	mux.HandleFunc("/seappearance/", Middleware(seDomainFirstAppearance))
 	mux.HandleFunc("/nuappearance/", Middleware(nuDomainFirstAppearance))
+	mux.HandleFunc("/export/", Middleware(RequireScope(auth.ScopeBulk, exportDay)))
+	mux.HandleFunc("/zone/", Middleware(RequireScope(auth.ScopeBulk, zoneExport)))
+	mux.HandleFunc("/feeds/", Middleware(tldFeed))
+
+	return CORS(tldRegistry.Config().CORS, mux)
+}
+
+// SetupAdminRoutes returns the routes of the admin listener, which is kept off the public port. With
+// a key backend the /admin routes also need a key with the admin scope; without one the listener is
+// the trust boundary.
+func SetupAdminRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	registerPoolMetrics()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/admin/pools", Middleware(RequireScope(auth.ScopeAdmin, poolStats)))
+	mux.HandleFunc("/admin/search-index", Middleware(RequireScope(auth.ScopeAdmin, searchIndexStats)))
+	mux.HandleFunc("/admin/cache/invalidate/", Middleware(RequireScope(auth.ScopeAdmin, invalidateCache)))
 
 	return mux
 }
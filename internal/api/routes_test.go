@@ -0,0 +1,49 @@
+package api
+
+import (
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminMetricsExportPools(t *testing.T) {
+	swap(t, &dbPoolStats, func() map[string]database.Stats {
+		return map[string]database.Stats{"se/dump": {MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}}
+	})
+
+	rr := httptest.NewRecorder()
+	SetupAdminRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rr.Code)
+	}
+	for _, want := range []string{
+		`axfr_db_pool_open_connections{database="dump",tld="se"} 3`,
+		`axfr_db_pool_in_use_connections{database="dump",tld="se"} 1`,
+		`axfr_db_pool_max_open_connections{database="dump",tld="se"} 10`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+}
+
+func TestAdminRoutesOnlyOnAdminListener(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{}))
+	swap(t, &authenticator, nil)
+
+	for _, path := range []string{"/admin/pools", "/admin/search-index"} {
+		rr := httptest.NewRecorder()
+		SetupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s on the public listener = %d, want 404", path, rr.Code)
+		}
+		rr = httptest.NewRecorder()
+		SetupAdminRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s on the admin listener = %d, want 200", path, rr.Code)
+		}
+	}
+}
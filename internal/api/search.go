@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-axfr-backend/internal/cache"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/ngram"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	searchModeContains = "contains"
+	searchModePrefix   = "prefix"
+	searchModeSuffix   = "suffix"
+	searchModeExact    = "exact"
+	searchModeGlob     = "glob"
+	searchModeRegex    = "regex"
+
+	// maxSearchResults caps the unpaginated /search/{tld}/{q} response.
+	maxSearchResults = 1000
+	maxSearchLength  = 255
+
+	// Regex search filters rows in Go, so a page scans at most regexScanBudget rows in
+	// batches of regexScanBatch before returning what it has with a cursor to continue.
+	regexScanBatch  = 5000
+	regexScanBudget = 200000
+)
+
+// likeEscape is the LIKE escape character; it avoids backslash, whose meaning depends on sql_mode.
+const likeEscape = "!"
+
+// searchQuery is a validated search term translated into a SQL condition on domains.domain, and
+// into an equivalent ngram.Query for the in-memory index.
+type searchQuery struct {
+	mode  string
+	term  string
+	cond  string
+	args  []interface{}
+	re    *regexp.Regexp
+	index ngram.Query
+}
+
+// escapeLike escapes LIKE wildcards so user input only ever matches literally.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+	return r.Replace(s)
+}
+
+// globToLike translates a shell glob (* and ?) into a LIKE pattern, escaping everything else.
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		default:
+			b.WriteString(escapeLike(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// globToRegexp translates a shell glob into an anchored regex, quoting everything else.
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^(?s:")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(")$")
+	return regexp.MustCompile(b.String())
+}
+
+// globLiterals returns the literal runs between the wildcards of a glob.
+func globLiterals(glob string) []string {
+	return strings.FieldsFunc(glob, func(r rune) bool { return r == '*' || r == '?' })
+}
+
+// anchoredPrefix returns the literal every match of a ^-anchored regex must start with, so the scan
+// can be narrowed in SQL. It returns "" when there is no such prefix.
+func anchoredPrefix(re *syntax.Regexp) string {
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	lit := re.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+	return string(lit.Rune)
+}
+
+func parseSearchQuery(mode string, term string) (searchQuery, error) {
+	if term == "" {
+		return searchQuery{}, badRequest("invalid_query", "empty search query")
+	}
+	if len(term) > maxSearchLength {
+		return searchQuery{}, badRequest("invalid_query", fmt.Sprintf("search query longer than %d characters", maxSearchLength))
+	}
+	if mode == "" {
+		mode = searchModeContains
+	}
+
+	sq := searchQuery{mode: mode, term: term}
+	if mode != searchModeRegex {
+		sq.term = strings.ToLower(term)
+	}
+
+	switch mode {
+	case searchModeContains:
+		sq.cond, sq.args = "domain LIKE ? ESCAPE '"+likeEscape+"'", []interface{}{"%" + escapeLike(sq.term) + "%"}
+		term := sq.term
+		sq.index = ngram.Query{Literals: []string{term}, Match: func(d string) bool { return strings.Contains(d, term) }}
+	case searchModePrefix:
+		sq.cond, sq.args = "domain LIKE ? ESCAPE '"+likeEscape+"'", []interface{}{escapeLike(sq.term) + "%"}
+		term := sq.term
+		sq.index = ngram.Query{Literals: []string{term}, Match: func(d string) bool { return strings.HasPrefix(d, term) }}
+	case searchModeSuffix:
+		sq.cond, sq.args = "domain LIKE ? ESCAPE '"+likeEscape+"'", []interface{}{"%" + escapeLike(sq.term)}
+		term := sq.term
+		sq.index = ngram.Query{Literals: []string{term}, Match: func(d string) bool { return strings.HasSuffix(d, term) }}
+	case searchModeExact:
+		sq.cond, sq.args = "domain = ?", []interface{}{sq.term}
+		term := sq.term
+		sq.index = ngram.Query{Literals: []string{term}, Match: func(d string) bool { return d == term }}
+	case searchModeGlob:
+		sq.cond, sq.args = "domain LIKE ? ESCAPE '"+likeEscape+"'", []interface{}{globToLike(sq.term)}
+		sq.index = ngram.Query{Literals: globLiterals(sq.term), Match: globToRegexp(sq.term).MatchString}
+	case searchModeRegex:
+		parsed, err := syntax.Parse(term, syntax.Perl)
+		if err != nil {
+			return searchQuery{}, badRequest("invalid_query", "invalid regex: "+err.Error())
+		}
+		sq.re, err = regexp.Compile(term)
+		if err != nil {
+			return searchQuery{}, badRequest("invalid_query", "invalid regex: "+err.Error())
+		}
+		sq.index.Match = sq.re.MatchString
+		if prefix := anchoredPrefix(parsed); prefix != "" {
+			sq.cond, sq.args = "domain LIKE ? ESCAPE '"+likeEscape+"'", []interface{}{escapeLike(prefix) + "%"}
+			sq.index.Literals = []string{prefix}
+		} else {
+			sq.cond = "1 = 1"
+		}
+	default:
+		return searchQuery{}, badRequest("invalid_mode", "unknown search mode: "+mode)
+	}
+	return sq, nil
+}
+
+// searchDomain serves the unpaginated search: matches ordered shortest first, capped at maxSearchResults.
+// It is answered from the TLD's search index when one has been built.
+func searchDomain(ctx context.Context, tld string, dumpdb config.Database, sq searchQuery) ([]domainRow, error) {
+	defer observeQuery(ctx, "search", sq.mode+" "+sq.term, time.Now())
+
+	if sq.re != nil {
+		return nil, badRequest("invalid_query", "regex search requires pagination")
+	}
+
+	var arr []domainRow
+
+	ix := getSearchIndex(tld)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("search.index", ix != nil))
+	if ix != nil {
+		matches := ix.Find(sq.index, "", false, -1)
+		// Matches are in domain order, the stable sort keeps it among domains of equal length.
+		slices.SortStableFunc(matches, func(a, b string) int { return len(a) - len(b) })
+		for _, domain := range matches[:min(len(matches), maxSearchResults)] {
+			arr = append(arr, domainRow{Domain: domain})
+		}
+	} else {
+		db, err := dbConn(ctx, dumpdb)
+		if err != nil {
+			return nil, errDatabase(err)
+		}
+
+		args := append(append([]interface{}{}, sq.args...), maxSearchResults)
+		rows, err := database.Query(ctx, db, "SELECT domain FROM domains WHERE "+sq.cond+" ORDER BY CHAR_LENGTH(domain) ASC LIMIT ?", args...)
+		if err != nil {
+			return nil, errQuery(err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var domain string
+			if err := rows.Scan(&domain); err != nil {
+				slog.WarnContext(ctx, "row scan failed", logging.Err(err))
+				continue
+			}
+			arr = append(arr, domainRow{Domain: domain})
+		}
+		if err := rows.Err(); err != nil {
+			return nil, errQuery(err)
+		}
+	}
+
+	return arr, nil
+}
+
+// searchRows fetches up to max domains matching cond after (or, in reverse, before) cur in domain order.
+func searchRows(ctx context.Context, db *sql.DB, cond string, condArgs []interface{}, cur *cursor, max int) ([]string, error) {
+	query := "SELECT domain FROM domains WHERE " + cond
+	args := append([]interface{}{}, condArgs...)
+	switch {
+	case cur == nil:
+		query += " ORDER BY domain ASC LIMIT ?"
+	case cur.Reverse:
+		query += " AND domain < ? ORDER BY domain DESC LIMIT ?"
+		args = append(args, cur.Domain)
+	default:
+		query += " AND domain > ? ORDER BY domain ASC LIMIT ?"
+		args = append(args, cur.Domain)
+	}
+	args = append(args, max)
+
+	rows, err := database.Query(ctx, db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make([]string, 0, max)
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// searchDomainKeyset serves one cursor page of search results in domain order. With a search index
+// the page is complete in one pass; regex scans in SQL are bounded by regexScanBudget.
+func searchDomainKeyset(ctx context.Context, tld string, dumpdb config.Database, sq searchQuery, cur *cursor, limit int) (keysetPage[domainRow], error) {
+	defer observeQuery(ctx, "search", sq.mode+" "+sq.term, time.Now())
+
+	var matches []string
+	var err error
+	// scanCursor is where a regex scan stopped when it ran out of budget before filling the page.
+	var scanCursor *cursor
+
+	ix := getSearchIndex(tld)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("search.index", ix != nil))
+	if ix != nil {
+		var after string
+		reverse := cur != nil && cur.Reverse
+		if cur != nil {
+			after = cur.Domain
+		}
+		matches = ix.Find(sq.index, after, reverse, limit+1)
+	} else if db, connErr := dbConn(ctx, dumpdb); connErr != nil {
+		return keysetPage[domainRow]{}, errDatabase(connErr)
+	} else if sq.re == nil {
+		matches, err = searchRows(ctx, db, sq.cond, sq.args, cur, limit+1)
+	} else {
+		pos := cur
+		scanned := 0
+		for len(matches) <= limit {
+			var batch []string
+			batch, err = searchRows(ctx, db, sq.cond, sq.args, pos, regexScanBatch)
+			if err != nil {
+				break
+			}
+			for _, domain := range batch {
+				if sq.re.MatchString(domain) {
+					matches = append(matches, domain)
+				}
+			}
+			scanned += len(batch)
+			if len(batch) < regexScanBatch {
+				break
+			}
+			pos = &cursor{Domain: batch[len(batch)-1], Reverse: cur != nil && cur.Reverse}
+			if scanned >= regexScanBudget && len(matches) <= limit {
+				scanCursor = pos
+				break
+			}
+		}
+	}
+	if err != nil {
+		return keysetPage[domainRow]{}, errQuery(err)
+	}
+
+	arr := make([]domainRow, 0, len(matches))
+	for _, domain := range matches {
+		arr = append(arr, domainRow{Domain: domain})
+	}
+
+	page := buildKeysetPage(arr, limit, cur, func(row domainRow) cursor {
+		return cursor{Domain: row.Domain}
+	})
+	if scanCursor != nil {
+		// More rows may match past the scan budget, continue from where the scan stopped.
+		token := scanCursor.encode()
+		if scanCursor.Reverse {
+			page.Prev = &token
+		} else {
+			page.Next = &token
+		}
+		page.Partial = true
+	}
+	return page, nil
+}
+
+func domainSearch(w http.ResponseWriter, r *http.Request) {
+	parts, err := getPathParams(r.URL.Path, 3)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tld, query := parts[1], parts[2]
+	db, err := getDumpDatabase(tld, config.EndpointSearch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	params := r.URL.Query()
+	mode := params.Get("mode")
+	sq, err := parseSearchQuery(mode, query)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Without mode, limit or cursor the original unpaginated response shape is kept.
+	paginated := params.Has("mode") || params.Has("limit") || params.Has("cursor")
+
+	var cacheKey string
+	var generate func(context.Context) (any, error)
+	if paginated {
+		cur, limit, err := parseKeysetParams(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		cacheKey = keysetCacheKey(fmt.Sprintf("search:%s:%s:%s", tld, sq.mode, sq.term), cur, limit)
+		generate = func(ctx context.Context) (any, error) {
+			return searchDomainKeyset(ctx, tld, db, sq, cur, limit)
+		}
+	} else {
+		cacheKey = fmt.Sprintf("search:%s:%s", tld, sq.term)
+		generate = func(ctx context.Context) (any, error) {
+			return searchDomain(ctx, tld, db, sq)
+		}
+	}
+
+	serveCached(w, r, cacheKey, ShortTTL, cache.Tags(tld, cache.DatasetDump), generate)
+}
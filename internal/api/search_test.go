@@ -0,0 +1,164 @@
+package api
+
+import (
+	"go-axfr-backend/internal/config"
+	"regexp/syntax"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "example", want: "example"},
+		{in: "50%", want: "50!%"},
+		{in: "a_b", want: "a!_b"},
+		{in: "wow!", want: "wow!!"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "*.se", want: "%.se"},
+		{in: "ab?.nu", want: "ab_.nu"},
+		{in: "100%_*", want: "100!%!_%"},
+	}
+
+	for _, tt := range tests {
+		if got := globToLike(tt.in); got != tt.want {
+			t.Errorf("globToLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "^abc", want: "abc"},
+		{pattern: "^abc.*\\.se$", want: "abc"},
+		{pattern: "abc", want: ""},
+		{pattern: "^(?i)abc", want: ""},
+		{pattern: "^ab|^cd", want: ""},
+		{pattern: "^[ab]c", want: ""},
+	}
+
+	for _, tt := range tests {
+		re, err := syntax.Parse(tt.pattern, syntax.Perl)
+		if err != nil {
+			t.Fatalf("syntax.Parse(%q) error = %v", tt.pattern, err)
+		}
+		if got := anchoredPrefix(re); got != tt.want {
+			t.Errorf("anchoredPrefix(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		term     string
+		wantErr  bool
+		wantCond string
+		wantArg  interface{}
+	}{
+		{name: "default contains", mode: "", term: "Ex_mple", wantCond: "domain LIKE ? ESCAPE '!'", wantArg: "%ex!_mple%"},
+		{name: "prefix", mode: "prefix", term: "abc", wantCond: "domain LIKE ? ESCAPE '!'", wantArg: "abc%"},
+		{name: "suffix", mode: "suffix", term: "shop.se", wantCond: "domain LIKE ? ESCAPE '!'", wantArg: "%shop.se"},
+		{name: "exact", mode: "exact", term: "Example.SE", wantCond: "domain = ?", wantArg: "example.se"},
+		{name: "glob", mode: "glob", term: "a*b?.se", wantCond: "domain LIKE ? ESCAPE '!'", wantArg: "a%b_.se"},
+		{name: "anchored regex", mode: "regex", term: "^shop[0-9]+\\.se$", wantCond: "domain LIKE ? ESCAPE '!'", wantArg: "shop%"},
+		{name: "unanchored regex", mode: "regex", term: "[0-9]{4}", wantCond: "1 = 1"},
+		{name: "PCRE-only regex", mode: "regex", term: "(?=abc)", wantErr: true},
+		{name: "unknown mode", mode: "fuzzy", term: "abc", wantErr: true},
+		{name: "empty term", mode: "prefix", term: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sq, err := parseSearchQuery(tt.mode, tt.term)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if sq.cond != tt.wantCond {
+				t.Errorf("parseSearchQuery() cond = %q, want %q", sq.cond, tt.wantCond)
+			}
+			if tt.wantArg != nil && (len(sq.args) != 1 || sq.args[0] != tt.wantArg) {
+				t.Errorf("parseSearchQuery() args = %v, want [%v]", sq.args, tt.wantArg)
+			}
+		})
+	}
+}
+
+func TestSearchQueryIndexMatch(t *testing.T) {
+	tests := []struct {
+		mode   string
+		term   string
+		domain string
+		want   bool
+	}{
+		{mode: "", term: "Shop", domain: "myshop.se", want: true},
+		{mode: "prefix", term: "shop", domain: "myshop.se", want: false},
+		{mode: "prefix", term: "shop", domain: "shop1.se", want: true},
+		{mode: "suffix", term: "op.se", domain: "shop.se", want: true},
+		{mode: "exact", term: "shop.se", domain: "shop1.se", want: false},
+		{mode: "glob", term: "s*p?.se", domain: "shop1.se", want: true},
+		{mode: "glob", term: "s*p?.se", domain: "shop.se", want: false},
+		{mode: "glob", term: "a.c", domain: "abc", want: false},
+		{mode: "regex", term: "^shop[0-9]+\\.se$", domain: "shop12.se", want: true},
+		{mode: "regex", term: "^shop[0-9]+\\.se$", domain: "shopx.se", want: false},
+	}
+
+	for _, tt := range tests {
+		sq, err := parseSearchQuery(tt.mode, tt.term)
+		if err != nil {
+			t.Fatalf("parseSearchQuery(%q, %q) error = %v", tt.mode, tt.term, err)
+		}
+		if got := sq.index.Match(tt.domain); got != tt.want {
+			t.Errorf("%s %q: Match(%q) = %v, want %v", tt.mode, tt.term, tt.domain, got, tt.want)
+		}
+		// Every match must contain the literals, or the index would miss it.
+		if tt.want {
+			for _, lit := range sq.index.Literals {
+				if !strings.Contains(tt.domain, lit) {
+					t.Errorf("%s %q: literal %q not in match %q", tt.mode, tt.term, lit, tt.domain)
+				}
+			}
+		}
+	}
+}
+
+func TestCloseSearchIndexesStopsLoop(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{SearchIndex: config.SearchIndex{Refresh: time.Hour}}))
+
+	InitSearchIndexes()
+	stopped := make(chan struct{})
+	go func() {
+		CloseSearchIndexes()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("CloseSearchIndexes() did not stop the refresh loop")
+	}
+	// Closing again, or without a loop, is a no-op.
+	CloseSearchIndexes()
+}
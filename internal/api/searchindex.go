@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"go-axfr-backend/internal/logging"
+	"go-axfr-backend/internal/ngram"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// searchIndexes holds the trigram index of every dump database with search enabled.
+var searchIndexes = struct {
+	sync.RWMutex
+	byTLD map[string]*ngram.Index
+}{byTLD: make(map[string]*ngram.Index)}
+
+// searchIndexLoop stops the refresh loop started by InitSearchIndexes; done is closed once it has.
+var searchIndexLoop struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// getSearchIndex returns the index for a TLD, or nil while none has been built.
+func getSearchIndex(tld string) *ngram.Index {
+	searchIndexes.RLock()
+	defer searchIndexes.RUnlock()
+	return searchIndexes.byTLD[tld]
+}
+
+// InitSearchIndexes builds the search indexes in the background and keeps rebuilding them whenever
+// a dump database gets new data. Searches fall back to SQL until an index is ready.
+func InitSearchIndexes() {
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	searchIndexLoop.stop, searchIndexLoop.done = stop, done
+
+	go func() {
+		defer close(done)
+		for {
+			refreshSearchIndexes(ctx)
+
+			interval := tldRegistry.Config().SearchIndex.Refresh
+			if interval <= 0 {
+				interval = config.DefaultSearchIndex.Refresh
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// CloseSearchIndexes stops the refresh loop, cancelling a rebuild in progress, for use on server
+// shutdown.
+func CloseSearchIndexes() {
+	if searchIndexLoop.stop == nil {
+		return
+	}
+	searchIndexLoop.stop()
+	<-searchIndexLoop.done
+	searchIndexLoop.stop, searchIndexLoop.done = nil, nil
+}
+
+func refreshSearchIndexes(ctx context.Context) {
+	cfg := tldRegistry.Config()
+
+	wanted := make(map[string]bool)
+	if cfg.SearchIndex.Enabled {
+		for _, name := range cfg.Names() {
+			tld := cfg.TLDs[name]
+			if tld.Dump == nil || !tld.Enabled(config.EndpointSearch) {
+				continue
+			}
+			wanted[name] = true
+			if err := refreshSearchIndex(ctx, name, *tld.Dump); err != nil {
+				slog.Warn("search index refresh failed", slog.String("tld", name), logging.Err(err))
+			}
+		}
+	}
+
+	searchIndexes.Lock()
+	for name := range searchIndexes.byTLD {
+		if !wanted[name] {
+			delete(searchIndexes.byTLD, name)
+			slog.Info("dropped search index", slog.String("tld", name))
+		}
+	}
+	searchIndexes.Unlock()
+}
+
+// refreshSearchIndex rebuilds a TLD's index when the dump's latest dates row has changed.
+// Every load of a dump adds a dates row, so its id identifies the data.
+func refreshSearchIndex(ctx context.Context, tld string, dumpdb config.Database) error {
+	db, err := dbConn(ctx, dumpdb)
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	if err := database.QueryRow(ctx, db, "SELECT COALESCE(MAX(id), 0) FROM dates").Scan(&version); err != nil {
+		return err
+	}
+	if current := getSearchIndex(tld); current != nil && current.Version == version {
+		return nil
+	}
+
+	start := time.Now()
+	rows, err := database.Query(ctx, db, "SELECT domain FROM domains")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return err
+		}
+		domains = append(domains, domain)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ix := ngram.Build(domains, version)
+	searchIndexes.Lock()
+	searchIndexes.byTLD[tld] = ix
+	searchIndexes.Unlock()
+
+	slog.Info("built search index", slog.String("tld", tld), slog.Int("domains", ix.Len()),
+		slog.Int("trigrams", ix.Trigrams()), slog.Int64("bytes", int64(ix.MemoryBytes())), slog.Duration("took", time.Since(start)))
+	return nil
+}
+
+func searchIndexStats(w http.ResponseWriter, r *http.Request) {
+	type Stats struct {
+		Domains     int       `json:"domains"`
+		Trigrams    int       `json:"trigrams"`
+		MemoryBytes int64     `json:"memory_bytes"`
+		Version     int64     `json:"version"`
+		BuiltAt     time.Time `json:"built_at"`
+	}
+
+	searchIndexes.RLock()
+	stats := make(map[string]Stats, len(searchIndexes.byTLD))
+	for tld, ix := range searchIndexes.byTLD {
+		stats[tld] = Stats{
+			Domains:     ix.Len(),
+			Trigrams:    ix.Trigrams(),
+			MemoryBytes: ix.MemoryBytes(),
+			Version:     ix.Version,
+			BuiltAt:     ix.BuiltAt,
+		}
+	}
+	searchIndexes.RUnlock()
+
+	writeValue(w, r, stats)
+}
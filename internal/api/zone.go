@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// zoneContentType is the media type of DNS master files, RFC 4027.
+const zoneContentType = "text/dns"
+
+// zonePlaceholderNS is the name server every delegation in a snapshot points to, as the dump keeps
+// no record data. The .invalid TLD never resolves, RFC 6761.
+const zonePlaceholderNS = "invalid."
+
+// zoneTTL is the $TTL of a snapshot, and its SOA timers are refresh, retry, expire and minimum.
+const (
+	zoneTTL       = 86400
+	zoneSOATimers = "86400 7200 3600000 3600"
+)
+
+// zoneEncoder writes domains as NS records with owner names relative to the zone origin, one per line.
+type zoneEncoder struct {
+	w *bufio.Writer
+	// suffix is the origin with a leading instead of a trailing dot, e.g. ".se".
+	suffix string
+}
+
+// newZoneEncoder writes the master file header of a snapshot: comments describing it, the $ORIGIN
+// and $TTL directives, and the apex SOA, with a serial generated from the date, and NS records.
+func newZoneEncoder(w io.Writer, origin string, date int, total int) zoneEncoder {
+	bw := bufio.NewWriter(w)
+	day := dayTime(date)
+	fmt.Fprintf(bw, "; Zone snapshot of %s taken %s\n", origin, day.Format(time.DateOnly))
+	fmt.Fprintf(bw, "; %d delegations; the snapshot keeps no record data, so they point to %s\n", total, zonePlaceholderNS)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(bw, "$TTL %d\n", zoneTTL)
+	fmt.Fprintf(bw, "@ IN SOA %s hostmaster.%s %s00 %s\n", zonePlaceholderNS, zonePlaceholderNS, day.Format("20060102"), zoneSOATimers)
+	fmt.Fprintf(bw, "@ IN NS %s\n", zonePlaceholderNS)
+	return zoneEncoder{w: bw, suffix: "." + strings.TrimSuffix(origin, ".")}
+}
+
+func (e zoneEncoder) encode(domain string) error {
+	if relative, ok := strings.CutSuffix(domain, e.suffix); ok && relative != "" {
+		e.w.WriteString(escapeOwner(relative))
+	} else {
+		// Names outside the origin are written fully qualified.
+		e.w.WriteString(escapeOwner(strings.TrimSuffix(domain, ".")) + ".")
+	}
+	e.w.WriteString(" IN NS " + zonePlaceholderNS)
+	return e.w.WriteByte('\n')
+}
+
+func (e zoneEncoder) flush() error {
+	return e.w.Flush()
+}
+
+// escapeOwner escapes the characters that are special in master files, RFC 1035 section 5.1.
+// Dots are left alone as they separate the labels.
+func escapeOwner(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c <= ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		case strings.IndexByte(`;()"\`, c) >= 0, i == 0 && (c == '@' || c == '$'):
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// zoneOrigin is the zone the TLD is transferred from, or the TLD itself.
+func zoneOrigin(tld string, entry *config.TLD) string {
+	if entry.AXFR != nil && entry.AXFR.Zone != "" {
+		return entry.AXFR.Zone
+	}
+	return tld + "."
+}
+
+// zoneExport streams the current snapshot of a dump database as a master file, /zone/{tld}.
+// Like /export it aborts the connection on a failure once rows are streaming.
+func zoneExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parts, err := getPathParams(r.URL.Path, 2)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tld := parts[1]
+	dumpdb, err := getDumpDatabase(tld, config.EndpointZone)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	entry, _ := tldRegistry.Lookup(tld)
+	db, err := dbConn(ctx, dumpdb)
+	if err != nil {
+		writeError(w, r, errDatabase(err))
+		return
+	}
+
+	start := time.Now()
+	var date, total int
+	err = database.QueryRow(ctx, db, "SELECT date FROM dates ORDER BY date DESC LIMIT 1").Scan(&date)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("no_snapshot", "no snapshot for TLD: "+tld))
+		return
+	}
+	if err == nil {
+		err = database.QueryRow(ctx, db, "SELECT COUNT(*) FROM domains").Scan(&total)
+	}
+	if err != nil {
+		writeError(w, r, errQuery(err))
+		return
+	}
+	observeQuery(ctx, "zone_count", tld, start)
+
+	rows, err := database.Query(ctx, db, "SELECT domain FROM domains ORDER BY domain ASC")
+	if err != nil {
+		writeError(w, r, errQuery(err))
+		return
+	}
+	defer rows.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", zoneContentType)
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.zone"`, tld, date))
+	h.Set("X-Total-Count", strconv.Itoa(total))
+	h.Set("X-Source-Date", strconv.Itoa(date))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("export.format", "zone"), attribute.Int("export.total", total))
+	origin := zoneOrigin(tld, entry)
+	streamDomains(w, r, rows, func(out io.Writer) exportEncoder {
+		return newZoneEncoder(out, origin, date, total)
+	})
+}
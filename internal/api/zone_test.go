@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"go-axfr-backend/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	domains := []string{"example.se", "a;b.se", "@home.se", "other.nu"}
+	enc := newZoneEncoder(&buf, "se.", 20250315, len(domains))
+	for _, domain := range domains {
+		enc.encode(domain)
+	}
+	if err := enc.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot must be a master file other DNS tools can read.
+	var soa []*dns.SOA
+	var owners []string
+	zp := dns.NewZoneParser(&buf, "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			soa = append(soa, rr)
+		case *dns.NS:
+			if rr.Hdr.Name != "se." {
+				owners = append(owners, rr.Hdr.Name)
+			}
+		default:
+			t.Errorf("unexpected record %s", rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("parsing the zone: %v", err)
+	}
+	if len(soa) != 1 || soa[0].Hdr.Name != "se." || soa[0].Serial != 2025031500 {
+		t.Errorf("SOA records = %v, want one for se. with serial 2025031500", soa)
+	}
+	want := []string{"example.se.", `a\;b.se.`, `\@home.se.`, "other.nu."}
+	if !slices.Equal(owners, want) {
+		t.Errorf("delegations = %q, want %q", owners, want)
+	}
+}
+
+func TestEscapeOwner(t *testing.T) {
+	tests := map[string]string{
+		"xn--rksmrgs-5wao1o": "xn--rksmrgs-5wao1o",
+		"a b":                `a\032b`,
+		`q"(x)\`:             `q\"\(x\)\\`,
+		"$ttl":               `\$ttl`,
+		"a$b":                "a$b",
+		"caf\xc3\xa9":        `caf\195\169`,
+	}
+	for name, want := range tests {
+		if got := escapeOwner(name); got != want {
+			t.Errorf("escapeOwner(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestZoneExportErrors(t *testing.T) {
+	swap(t, &tldRegistry, config.NewRegistry(&config.Config{TLDs: map[string]*config.TLD{
+		"se": {Dump: &config.Database{Name: "sedump"}, Endpoints: []string{config.EndpointSearch}},
+	}}))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/zone/se/extra", http.StatusBadRequest},
+		{"/zone/xx", http.StatusNotFound},
+		{"/zone/se", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		zoneExport(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rr.Code != tt.wantStatus || rr.Header().Get("X-Total-Count") != "" {
+			t.Errorf("GET %s = %d, want %d without export headers", tt.path, rr.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestZoneOrigin(t *testing.T) {
+	if got := zoneOrigin("se", &config.TLD{}); got != "se." {
+		t.Errorf("zoneOrigin() = %q, want the TLD", got)
+	}
+	if got := zoneOrigin("se", &config.TLD{AXFR: &config.AXFR{Zone: "example.se."}}); got != "example.se." {
+		t.Errorf("zoneOrigin() = %q, want the transferred zone", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Package auth authenticates API keys and enforces their request quotas. Keys are stored by their
+// SHA-256 hash, in a YAML file or a MySQL table, and quotas are counted per key name in Redis or memory.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes grant access to endpoints that are not open to every key.
+const (
+	// ScopeBulk covers the bulk export endpoints.
+	ScopeBulk = "bulk"
+	// ScopeAdmin covers the /admin endpoints.
+	ScopeAdmin = "admin"
+)
+
+// Header is the header a key can be sent in, as an alternative to "Authorization: Bearer <key>".
+const Header = "X-API-Key"
+
+var (
+	ErrUnknownKey = errors.New("unknown API key")
+	ErrDisabled   = errors.New("API key is disabled")
+)
+
+// Key is a client's API key.
+type Key struct {
+	Name    string   `yaml:"name"`
+	Enabled bool     `yaml:"enabled"`
+	Scopes  []string `yaml:"scopes"`
+	// DailyQuota and MonthlyQuota cap the requests per UTC day and month; zero means unlimited.
+	DailyQuota   int64 `yaml:"daily_quota"`
+	MonthlyQuota int64 `yaml:"monthly_quota"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k *Key) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Hash returns the hex SHA-256 of a key as stored by the backends.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store looks up keys by their hash.
+type Store interface {
+	// Lookup returns the key with the given hash, or ErrUnknownKey.
+	Lookup(ctx context.Context, hash string) (*Key, error)
+	Close() error
+}
+
+// Usage is a key's request count in the current UTC day and month, including the request being counted.
+type Usage struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Quotas counts requests per key name.
+type Quotas interface {
+	// Use counts one request made at now and returns the updated usage.
+	Use(ctx context.Context, name string, now time.Time) (Usage, error)
+	Close() error
+}
+
+// QuotaExceededError reports a key that used up its daily or monthly quota.
+type QuotaExceededError struct {
+	Period string
+	Limit  int64
+	// Reset is when the period ends and the quota is available again.
+	Reset time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %d requests exceeded", e.Period, e.Limit)
+}
+
+// FromRequest returns the key sent with r in the X-API-Key header or as a bearer token, or "".
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get(Header); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// Authenticator checks keys against a store and counts them against their quotas.
+type Authenticator struct {
+	Store  Store
+	Quotas Quotas
+	// Required rejects requests without a key.
+	Required bool
+	// Now returns the current time, for tests.
+	Now func() time.Time
+}
+
+// Identify returns the key sent with r, or nil for an anonymous request when keys are optional.
+// Errors are ErrUnknownKey (also for a missing key when one is required) or ErrDisabled; any other
+// error means the store failed. The request is not counted against the key's quotas.
+func (a *Authenticator) Identify(ctx context.Context, r *http.Request) (*Key, error) {
+	token := FromRequest(r)
+	if token == "" {
+		if a.Required {
+			return nil, ErrUnknownKey
+		}
+		return nil, nil
+	}
+
+	key, err := a.Store.Lookup(ctx, Hash(token))
+	if err != nil {
+		return nil, err
+	}
+	if !key.Enabled {
+		return key, ErrDisabled
+	}
+	return key, nil
+}
+
+// Charge counts one request against key's quotas. It returns a *QuotaExceededError once one is used
+// up; any other error means the quota backend failed.
+func (a *Authenticator) Charge(ctx context.Context, key *Key) error {
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	usage, err := a.Quotas.Use(ctx, key.Name, now)
+	if err != nil {
+		return fmt.Errorf("counting requests for key %s: %w", key.Name, err)
+	}
+	day, month := periodStarts(now)
+	if key.DailyQuota > 0 && usage.Daily > key.DailyQuota {
+		return &QuotaExceededError{Period: "daily", Limit: key.DailyQuota, Reset: day.AddDate(0, 0, 1)}
+	}
+	if key.MonthlyQuota > 0 && usage.Monthly > key.MonthlyQuota {
+		return &QuotaExceededError{Period: "monthly", Limit: key.MonthlyQuota, Reset: month.AddDate(0, 1, 0)}
+	}
+	return nil
+}
+
+// periodStarts returns the start of the UTC day and month of now.
+func periodStarts(now time.Time) (day time.Time, month time.Time) {
+	now = now.UTC()
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeys(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileStore(t *testing.T) {
+	path := writeKeys(t, `
+keys:
+  - name: partner
+    key_sha256: `+Hash("s3cret")+`
+    enabled: true
+    scopes: [bulk]
+`)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	key, err := store.Lookup(context.Background(), Hash("s3cret"))
+	if err != nil || key.Name != "partner" || !key.HasScope(ScopeBulk) || key.HasScope(ScopeAdmin) {
+		t.Errorf("Lookup() = %+v, %v", key, err)
+	}
+	if _, err := store.Lookup(context.Background(), Hash("other")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Lookup(unknown) error = %v, want ErrUnknownKey", err)
+	}
+
+	os.WriteFile(path, []byte("keys:\n  - name: partner\n    key_sha256: s3cret\n"), 0o600)
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() accepted a plaintext key")
+	}
+	if store.Len() != 1 {
+		t.Errorf("Len() after rejected reload = %d, want 1", store.Len())
+	}
+}
+
+func testAuthenticator(t *testing.T, now *time.Time) *Authenticator {
+	t.Helper()
+	store, err := NewFileStore(writeKeys(t, `
+keys:
+  - {name: limited, key_sha256: `+Hash("limited")+`, enabled: true, daily_quota: 2}
+  - {name: off, key_sha256: `+Hash("off")+`, enabled: false}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Authenticator{Store: store, Quotas: NewMemoryQuotas(), Now: func() time.Time { return *now }}
+}
+
+func request(header string, value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestIdentify(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	a := testAuthenticator(t, &now)
+	ctx := context.Background()
+
+	if key, err := a.Identify(ctx, request("", "")); key != nil || err != nil {
+		t.Errorf("anonymous = %v, %v, want allowed when keys are optional", key, err)
+	}
+	if _, err := a.Identify(ctx, request(Header, "nope")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key error = %v", err)
+	}
+	if _, err := a.Identify(ctx, request(Header, "off")); !errors.Is(err, ErrDisabled) {
+		t.Errorf("disabled key error = %v", err)
+	}
+
+	// Identifying never counts against the quota, so requests rejected later, e.g. by the rate
+	// limiter, are not charged.
+	for i := 0; i < 5; i++ {
+		if key, err := a.Identify(ctx, request("Authorization", "Bearer limited")); err != nil || key.Name != "limited" {
+			t.Fatalf("request %d = %v, %v", i, key, err)
+		}
+	}
+	if usage, _ := a.Quotas.Use(ctx, "limited", now); usage.Daily != 1 {
+		t.Errorf("daily usage after Identify() = %d, want only the Use() of this check", usage.Daily)
+	}
+
+	a.Required = true
+	if _, err := a.Identify(ctx, request("", "")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("anonymous with required keys error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestCharge(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	a := testAuthenticator(t, &now)
+	ctx := context.Background()
+	key, err := a.Identify(ctx, request(Header, "limited"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := a.Charge(ctx, key); err != nil {
+			t.Fatalf("request %d error = %v", i, err)
+		}
+	}
+	var quotaErr *QuotaExceededError
+	if err := a.Charge(ctx, key); !errors.As(err, &quotaErr) ||
+		quotaErr.Period != "daily" || !quotaErr.Reset.Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("over quota error = %v, want the daily quota resetting at midnight", err)
+	}
+
+	// The next day starts a fresh daily count.
+	now = now.Add(24 * time.Hour)
+	if err := a.Charge(ctx, key); err != nil {
+		t.Errorf("next day error = %v", err)
+	}
+}
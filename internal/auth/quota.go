@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// quotaKeys returns the counter names of a key's current UTC day and month.
+func quotaKeys(name string, now time.Time) (day string, month string) {
+	now = now.UTC()
+	return "quota:" + name + ":" + now.Format("20060102"), "quota:" + name + ":" + now.Format("200601")
+}
+
+// MemoryQuotas counts requests in process memory, so each node enforces quotas on its own share.
+type MemoryQuotas struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	day    string
+}
+
+func NewMemoryQuotas() *MemoryQuotas {
+	return &MemoryQuotas{counts: make(map[string]int64)}
+}
+
+func (q *MemoryQuotas) Use(_ context.Context, name string, now time.Time) (Usage, error) {
+	day, month := quotaKeys(name, now)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Counters of past periods are dropped when the day changes, keeping this month's.
+	if today := now.UTC().Format("20060102"); today != q.day {
+		for k := range q.counts {
+			if period := k[strings.LastIndexByte(k, ':')+1:]; period != today[:6] {
+				delete(q.counts, k)
+			}
+		}
+		q.day = today
+	}
+	q.counts[day]++
+	q.counts[month]++
+	return Usage{Daily: q.counts[day], Monthly: q.counts[month]}, nil
+}
+
+func (q *MemoryQuotas) Close() error {
+	return nil
+}
+
+// RedisQuotas counts requests in Redis, shared by every node. Counters expire after their period.
+type RedisQuotas struct {
+	client *redis.Client
+}
+
+// NewRedisQuotas counts requests on the Redis server at addr.
+func NewRedisQuotas(addr string) *RedisQuotas {
+	return &RedisQuotas{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (q *RedisQuotas) Use(ctx context.Context, name string, now time.Time) (Usage, error) {
+	day, month := quotaKeys(name, now)
+
+	pipe := q.client.TxPipeline()
+	daily := pipe.Incr(ctx, day)
+	pipe.ExpireNX(ctx, day, 48*time.Hour)
+	monthly := pipe.Incr(ctx, month)
+	pipe.ExpireNX(ctx, month, 32*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Usage{}, err
+	}
+	return Usage{Daily: daily.Val(), Monthly: monthly.Val()}, nil
+}
+
+func (q *RedisQuotas) Close() error {
+	return q.client.Close()
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-axfr-backend/internal/database"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileStore holds the keys of a YAML file:
+//
+//	keys:
+//	  - name: partner-a
+//	    key_sha256: <hex SHA-256 of the key>
+//	    enabled: true
+//	    daily_quota: 10000
+//	    scopes: [bulk]
+type FileStore struct {
+	path string
+	keys atomic.Pointer[map[string]*Key]
+}
+
+type fileKey struct {
+	Key       `yaml:",inline"`
+	KeySHA256 string `yaml:"key_sha256"`
+}
+
+// NewFileStore loads the key file at path.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the key file. On error the previous keys stay active.
+func (s *FileStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("reading key file %s: %w", s.path, err)
+	}
+
+	var file struct {
+		Keys []fileKey `yaml:"keys"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return fmt.Errorf("parsing key file %s: %w", s.path, err)
+	}
+
+	keys := make(map[string]*Key, len(file.Keys))
+	names := make(map[string]bool, len(file.Keys))
+	for i, k := range file.Keys {
+		if k.Name == "" {
+			return fmt.Errorf("key file %s: key %d has no name", s.path, i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("key file %s: duplicate key name %s", s.path, k.Name)
+		}
+		hash := strings.ToLower(k.KeySHA256)
+		if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+			return fmt.Errorf("key file %s: key %s: key_sha256 must be 64 hex digits", s.path, k.Name)
+		}
+		names[k.Name] = true
+		key := k.Key
+		keys[hash] = &key
+	}
+	s.keys.Store(&keys)
+	return nil
+}
+
+// ReloadOnSignal reloads the key file every time one of sig is received until stop is called.
+func (s *FileStore) ReloadOnSignal(sig ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sg := <-ch:
+				if err := s.Reload(); err != nil {
+					slog.Error("API key reload failed, keeping previous keys", slog.String("signal", sg.String()), slog.Any("error", err))
+					continue
+				}
+				slog.Info("API keys reloaded", slog.String("signal", sg.String()), slog.Int("keys", s.Len()))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Len returns the number of loaded keys.
+func (s *FileStore) Len() int {
+	return len(*s.keys.Load())
+}
+
+func (s *FileStore) Lookup(_ context.Context, hash string) (*Key, error) {
+	if key, ok := (*s.keys.Load())[hash]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// mysqlLookupTTL is how long MySQLStore reuses a lookup, so a key change applies within it.
+const mysqlLookupTTL = 30 * time.Second
+
+// MySQLStore reads keys from an api_keys table:
+//
+//	CREATE TABLE api_keys (
+//	  key_sha256 CHAR(64) PRIMARY KEY,
+//	  name VARCHAR(64) NOT NULL UNIQUE,
+//	  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+//	  daily_quota BIGINT NOT NULL DEFAULT 0,
+//	  monthly_quota BIGINT NOT NULL DEFAULT 0,
+//	  scopes VARCHAR(255) NOT NULL DEFAULT ''
+//	);
+//
+// scopes is comma separated. Lookups, including unknown keys, are cached for mysqlLookupTTL.
+type MySQLStore struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	lookups map[string]mysqlLookup
+	now     func() time.Time
+}
+
+type mysqlLookup struct {
+	key     *Key
+	expires time.Time
+}
+
+// NewMySQLStore reads keys through db. The pool stays owned by the caller.
+func NewMySQLStore(db *sql.DB) *MySQLStore {
+	return &MySQLStore{db: db, lookups: make(map[string]mysqlLookup), now: time.Now}
+}
+
+func (s *MySQLStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	now := s.now()
+	s.mu.Lock()
+	cached, ok := s.lookups[hash]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		if cached.key == nil {
+			return nil, ErrUnknownKey
+		}
+		return cached.key, nil
+	}
+
+	var key Key
+	var scopes string
+	err := database.QueryRow(ctx, s.db,
+		"SELECT name, enabled, daily_quota, monthly_quota, scopes FROM api_keys WHERE key_sha256 = ?", hash,
+	).Scan(&key.Name, &key.Enabled, &key.DailyQuota, &key.MonthlyQuota, &scopes)
+	var found *Key
+	switch {
+	case err == nil:
+		for scope := range strings.SplitSeq(scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				key.Scopes = append(key.Scopes, scope)
+			}
+		}
+		found = &key
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("looking up API key: %w", err)
+	}
+
+	s.mu.Lock()
+	// Expired entries are dropped lazily; the map is bounded by the number of distinct keys tried.
+	if len(s.lookups) > 10000 {
+		clear(s.lookups)
+	}
+	s.lookups[hash] = mysqlLookup{key: found, expires: now.Add(mysqlLookupTTL)}
+	s.mu.Unlock()
+
+	if found == nil {
+		return nil, ErrUnknownKey
+	}
+	return found, nil
+}
+
+func (s *MySQLStore) Close() error {
+	return nil
+}
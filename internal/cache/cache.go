@@ -0,0 +1,85 @@
+// Package cache provides the response cache backends: an in-process LRU, Redis, and a tiered
+// combination of both.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-axfr-backend/internal/config"
+	"time"
+)
+
+// ErrMiss is returned by Get when a key is absent or expired.
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores opaque values under string keys. Values returned by Get must not be modified.
+// A ttl of zero or less stores a value without expiry. Keys can carry tags, and Invalidate drops
+// every key carrying any of the given tags.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	Delete(ctx context.Context, keys ...string) error
+	Invalidate(ctx context.Context, tags ...string) error
+	Close() error
+}
+
+// Datasets a cached response can be generated from.
+const (
+	DatasetDump = "dump"
+	DatasetDiff = "diff"
+)
+
+// TLDTag tags every key of a TLD.
+func TLDTag(tld string) string {
+	return "tld:" + tld
+}
+
+// DatasetTag tags the keys generated from one of a TLD's databases.
+func DatasetTag(tld string, dataset string) string {
+	return "tld:" + tld + ":" + dataset
+}
+
+// Tags returns the tags of a response for tld generated from datasets.
+func Tags(tld string, datasets ...string) []string {
+	tags := []string{TLDTag(tld)}
+	for _, dataset := range datasets {
+		tags = append(tags, DatasetTag(tld, dataset))
+	}
+	return tags
+}
+
+// Nop caches nothing; every Get is a miss.
+type Nop struct{}
+
+func (Nop) Get(ctx context.Context, key string) ([]byte, error) { return nil, ErrMiss }
+
+func (Nop) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	return nil
+}
+
+func (Nop) Delete(ctx context.Context, keys ...string) error { return nil }
+
+func (Nop) Invalidate(ctx context.Context, tags ...string) error { return nil }
+
+func (Nop) Close() error { return nil }
+
+// New builds the backend selected by cfg. Redis backends are pinged and fail when it is unreachable.
+func New(ctx context.Context, cfg config.Cache) (Cache, error) {
+	switch cfg.Backend {
+	case config.CacheNone:
+		return Nop{}, nil
+	case config.CacheMemory:
+		return NewMemory(cfg.MaxEntries, cfg.MaxBytes), nil
+	case config.CacheRedis:
+		return NewRedis(ctx, cfg.Redis)
+	case config.CacheTiered:
+		l2, err := NewRedis(ctx, cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		return NewTiered(NewMemory(cfg.MaxEntries, cfg.MaxBytes), l2, cfg.L1TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache bounded by entry count and by the bytes of its keys and values.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	order      *list.List // front is most recently used
+	items      map[string]*list.Element
+	tagged     map[string]map[string]struct{} // tag -> keys
+
+	now func() time.Time
+}
+
+type memoryItem struct {
+	key     string
+	value   []byte
+	expires time.Time // zero means no expiry
+	tags    []string
+}
+
+func (it *memoryItem) size() int64 {
+	return int64(len(it.key) + len(it.value))
+}
+
+// NewMemory returns an empty LRU. A zero maxEntries or maxBytes leaves that dimension unbounded.
+func NewMemory(maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		tagged:     make(map[string]map[string]struct{}),
+		now:        time.Now,
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	it := el.Value.(*memoryItem)
+	if !it.expires.IsZero() && !m.now().Before(it.expires) {
+		m.remove(el)
+		return nil, ErrMiss
+	}
+	m.order.MoveToFront(el)
+	return it.value, nil
+}
+
+// Set stores value, evicting the least recently used entries as needed. A value larger than the
+// byte bound on its own is not stored.
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	it := &memoryItem{key: key, value: value, tags: tags}
+	if ttl > 0 {
+		it.expires = m.now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	if m.maxBytes > 0 && it.size() > m.maxBytes {
+		return nil
+	}
+
+	m.items[key] = m.order.PushFront(it)
+	m.bytes += it.size()
+	for _, tag := range tags {
+		keys, ok := m.tagged[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			m.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	for (m.maxEntries > 0 && m.order.Len() > m.maxEntries) || (m.maxBytes > 0 && m.bytes > m.maxBytes) {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := m.items[key]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Invalidate(ctx context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range m.tagged[tag] {
+			m.remove(m.items[key])
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Len returns the number of stored entries, including expired ones not yet evicted.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// Bytes returns the size of the stored keys and values.
+func (m *Memory) Bytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bytes
+}
+
+// remove drops an element; m.mu must be held.
+func (m *Memory) remove(el *list.Element) {
+	it := m.order.Remove(el).(*memoryItem)
+	delete(m.items, it.key)
+	m.bytes -= it.size()
+	for _, tag := range it.tags {
+		delete(m.tagged[tag], it.key)
+		if len(m.tagged[tag]) == 0 {
+			delete(m.tagged, tag)
+		}
+	}
+}
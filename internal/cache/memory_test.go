@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2, 0)
+
+	m.Set(ctx, "a", []byte("1"), 0)
+	m.Set(ctx, "b", []byte("2"), 0)
+	if _, err := m.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get(a) error = %v", err)
+	}
+	m.Set(ctx, "c", []byte("3"), 0)
+
+	if _, err := m.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(b) error = %v, want ErrMiss for the least recently used key", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := m.Get(ctx, key); err != nil {
+			t.Errorf("Get(%s) error = %v", key, err)
+		}
+	}
+}
+
+func TestMemoryByteBound(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0, 10)
+
+	m.Set(ctx, "a", []byte("1234"), 0) // 5 bytes
+	m.Set(ctx, "b", []byte("1234"), 0) // 10 bytes
+	m.Set(ctx, "c", []byte("1234"), 0) // evicts a
+	if m.Bytes() != 10 || m.Len() != 2 {
+		t.Errorf("Bytes() = %d, Len() = %d, want 10 and 2", m.Bytes(), m.Len())
+	}
+	if _, err := m.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(a) error = %v, want ErrMiss", err)
+	}
+
+	m.Set(ctx, "huge", make([]byte, 64), 0)
+	if _, err := m.Get(ctx, "huge"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(huge) error = %v, want oversized values not stored", err)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d, oversized value must not evict others", m.Len())
+	}
+
+	m.Set(ctx, "b", []byte("1"), 0)
+	if m.Bytes() != 7 {
+		t.Errorf("Bytes() = %d after replacing b, want 7", m.Bytes())
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1742000000, 0)
+	m := NewMemory(0, 0)
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "a", []byte("1"), time.Minute)
+	m.Set(ctx, "b", []byte("2"), 0)
+
+	now = now.Add(time.Minute)
+	if _, err := m.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(a) error = %v, want ErrMiss after ttl", err)
+	}
+	if _, err := m.Get(ctx, "b"); err != nil {
+		t.Errorf("Get(b) error = %v, want no expiry for ttl 0", err)
+	}
+
+	m.Delete(ctx, "b", "missing")
+	if m.Len() != 0 || m.Bytes() != 0 {
+		t.Errorf("Len() = %d, Bytes() = %d after Delete, want empty", m.Len(), m.Bytes())
+	}
+}
+
+func TestMemoryInvalidate(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0, 0)
+
+	m.Set(ctx, "sedates:page:0", []byte("1"), 0, Tags("se", DatasetDiff)...)
+	m.Set(ctx, "stats:se", []byte("2"), 0, Tags("se", DatasetDump)...)
+	m.Set(ctx, "stats:nu", []byte("3"), 0, Tags("nu", DatasetDump)...)
+
+	m.Invalidate(ctx, DatasetTag("se", DatasetDump))
+	if _, err := m.Get(ctx, "stats:se"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(stats:se) error = %v, want invalidated", err)
+	}
+	if _, err := m.Get(ctx, "sedates:page:0"); err != nil {
+		t.Errorf("Get(sedates:page:0) error = %v, diff keys must survive a dump invalidation", err)
+	}
+
+	m.Invalidate(ctx, TLDTag("se"))
+	if m.Len() != 1 {
+		t.Errorf("Len() = %d after invalidating se, want only stats:nu left", m.Len())
+	}
+	if len(m.tagged) != 2 {
+		t.Errorf("tag index has %d tags, want only nu's", len(m.tagged))
+	}
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel is the pub/sub channel invalidated tags are announced on, one message per
+// Invalidate with the tags separated by newlines, so every node can drop its local copies.
+const InvalidationChannel = "axfr:cache:invalidate"
+
+// tagSetTTL is the minimum lifetime of a tag's key set. Every Set extends it, so the set outlives
+// its members while the tag is in use and disappears once it is not.
+const tagSetTTL = 48 * time.Hour
+
+// invalidateBatchSize bounds the keys per UNLINK when a tag is invalidated.
+const invalidateBatchSize = 1000
+
+// tagSetKey names the sorted set of a tag's keys, scored by their expiry in Unix milliseconds. It
+// replaced a plain set under "tag:", so both can coexist while the old sets expire.
+func tagSetKey(tag string) string {
+	return "tags:" + tag
+}
+
+// taggedValueMagic prefixes values stored with their tags, so a node that reads a key from Redis
+// into its local cache can tag the local copy too. Values without it are returned as-is.
+const taggedValueMagic = "AXT1"
+
+func encodeTaggedValue(value []byte, tags []string) []byte {
+	joined := strings.Join(tags, "\n")
+	buf := make([]byte, 0, len(taggedValueMagic)+binary.MaxVarintLen64+len(joined)+len(value))
+	buf = append(buf, taggedValueMagic...)
+	buf = binary.AppendUvarint(buf, uint64(len(joined)))
+	buf = append(buf, joined...)
+	return append(buf, value...)
+}
+
+func decodeTaggedValue(raw []byte) ([]byte, []string) {
+	if !bytes.HasPrefix(raw, []byte(taggedValueMagic)) {
+		return raw, nil
+	}
+	rest := raw[len(taggedValueMagic):]
+	n, size := binary.Uvarint(rest)
+	if size <= 0 || uint64(len(rest)-size) < n {
+		return raw, nil
+	}
+	rest = rest[size:]
+	var tags []string
+	if n > 0 {
+		tags = strings.Split(string(rest[:n]), "\n")
+	}
+	return rest[n:], tags
+}
+
+// Redis is a cache shared by every server node.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at addr and checks that it answers.
+func NewRedis(ctx context.Context, addr string) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis at %s: %w", addr, err)
+	}
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	val, _, err := r.GetTagged(ctx, key)
+	return val, err
+}
+
+// GetTagged returns a value together with the tags it was stored with.
+func (r *Redis) GetTagged(ctx context.Context, key string) ([]byte, []string, error) {
+	raw, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrMiss
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	val, tags := decodeTaggedValue(raw)
+	return val, tags, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	now := time.Now()
+	expiry := math.Inf(1)
+	if ttl > 0 {
+		expiry = float64(now.Add(ttl).UnixMilli())
+	}
+	// Members whose keys have expired are pruned on every Set, so a tag in constant use does not
+	// collect every key it ever had.
+	expired := strconv.FormatInt(now.UnixMilli(), 10)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, encodeTaggedValue(value, tags), ttl)
+		for _, tag := range tags {
+			pipe.ZAdd(ctx, tagSetKey(tag), redis.Z{Score: expiry, Member: key})
+			pipe.ZRemRangeByScore(ctx, tagSetKey(tag), "-inf", expired)
+			pipe.Expire(ctx, tagSetKey(tag), max(ttl, tagSetTTL))
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Invalidate deletes the tagged keys and announces the tags on InvalidationChannel.
+func (r *Redis) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	for _, tag := range tags {
+		if err := r.invalidateTag(ctx, tag); err != nil {
+			return fmt.Errorf("invalidating %s: %w", tag, err)
+		}
+	}
+	return r.client.Publish(ctx, InvalidationChannel, strings.Join(tags, "\n")).Err()
+}
+
+// invalidateTag unlinks the keys in a tag's set in batches and removes them from the set. Keys
+// first tagged while it runs stay in the set for the next invalidation. Only the keys read from the set
+// are touched, so no key has to live in the set's cluster slot.
+func (r *Redis) invalidateTag(ctx context.Context, tag string) error {
+	keys, err := r.client.ZRange(ctx, tagSetKey(tag), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += invalidateBatchSize {
+		batch := keys[start:min(start+invalidateBatchSize, len(keys))]
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return err
+		}
+		members := make([]any, len(batch))
+		for i, key := range batch {
+			members[i] = key
+		}
+		if err := r.client.ZRem(ctx, tagSetKey(tag), members...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe calls fn with the tags of every invalidation announced by any node until ctx is done.
+func (r *Redis) Subscribe(ctx context.Context, fn func(tags []string)) {
+	sub := r.client.Subscribe(ctx, InvalidationChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				slog.Warn("cache invalidation subscription closed")
+				return
+			}
+			fn(strings.Split(msg.Payload, "\n"))
+		}
+	}
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestTaggedValue(t *testing.T) {
+	value := []byte(`{"items":[]}`)
+	tags := Tags("se", DatasetDiff)
+
+	got, gotTags := decodeTaggedValue(encodeTaggedValue(value, tags))
+	if !bytes.Equal(got, value) || !slices.Equal(gotTags, tags) {
+		t.Errorf("decodeTaggedValue() = %q, %v, want %q, %v", got, gotTags, value, tags)
+	}
+
+	got, gotTags = decodeTaggedValue(encodeTaggedValue(value, nil))
+	if !bytes.Equal(got, value) || gotTags != nil {
+		t.Errorf("untagged round trip = %q, %v", got, gotTags)
+	}
+
+	// Values written before tagging are returned unchanged.
+	if got, gotTags := decodeTaggedValue(value); !bytes.Equal(got, value) || gotTags != nil {
+		t.Errorf("legacy value = %q, %v", got, gotTags)
+	}
+}
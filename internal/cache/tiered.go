@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Tiered serves hot keys from a local L1 in front of a shared L2. L1 copies live at most l1TTL, which
+// bounds how long a node keeps serving a value after another node replaced it in L2. When L2
+// announces invalidations, as Redis does, L1 drops the invalidated tags right away.
+type Tiered struct {
+	l1    Cache
+	l2    Cache
+	l1TTL time.Duration
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// taggedGetter is implemented by shared caches that return the tags a value was stored with, so
+// the L1 copy can be invalidated like the original.
+type taggedGetter interface {
+	GetTagged(ctx context.Context, key string) ([]byte, []string, error)
+}
+
+// subscriber is implemented by shared caches that announce invalidations from every node.
+type subscriber interface {
+	Subscribe(ctx context.Context, fn func(tags []string))
+}
+
+func NewTiered(l1 Cache, l2 Cache, l1TTL time.Duration) *Tiered {
+	ctx, stop := context.WithCancel(context.Background())
+	t := &Tiered{l1: l1, l2: l2, l1TTL: l1TTL, stop: stop, done: make(chan struct{})}
+
+	go func() {
+		defer close(t.done)
+		if sub, ok := l2.(subscriber); ok {
+			sub.Subscribe(ctx, func(tags []string) {
+				t.l1.Invalidate(ctx, tags...)
+			})
+		}
+	}()
+	return t
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	if val, err := t.l1.Get(ctx, key); err == nil {
+		return val, nil
+	}
+
+	var val []byte
+	var tags []string
+	var err error
+	if tg, ok := t.l2.(taggedGetter); ok {
+		val, tags, err = tg.GetTagged(ctx, key)
+	} else {
+		val, err = t.l2.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.l1.Set(ctx, key, val, t.l1TTL, tags...)
+	return val, nil
+}
+
+// Set writes through to L2 and keeps a local copy for at most l1TTL.
+func (t *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	l1TTL := t.l1TTL
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+	t.l1.Set(ctx, key, value, l1TTL, tags...)
+	return t.l2.Set(ctx, key, value, ttl, tags...)
+}
+
+func (t *Tiered) Delete(ctx context.Context, keys ...string) error {
+	return errors.Join(t.l1.Delete(ctx, keys...), t.l2.Delete(ctx, keys...))
+}
+
+// Invalidate drops the tags from L2, which announces them to the other nodes, and from L1.
+func (t *Tiered) Invalidate(ctx context.Context, tags ...string) error {
+	return errors.Join(t.l2.Invalidate(ctx, tags...), t.l1.Invalidate(ctx, tags...))
+}
+
+func (t *Tiered) Close() error {
+	t.stop()
+	<-t.done
+	return errors.Join(t.l1.Close(), t.l2.Close())
+}
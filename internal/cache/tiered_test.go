@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemory(0, 0), NewMemory(0, 0)
+	tiered := NewTiered(l1, l2, 30*time.Second)
+
+	l2.Set(ctx, "shared", []byte("from l2"), time.Hour)
+	val, err := tiered.Get(ctx, "shared")
+	if err != nil || string(val) != "from l2" {
+		t.Fatalf("Get(shared) = %q, %v, want the L2 value", val, err)
+	}
+	if _, err := l1.Get(ctx, "shared"); err != nil {
+		t.Errorf("L2 hit was not copied to L1: %v", err)
+	}
+
+	tiered.Set(ctx, "k", []byte("v"), time.Hour)
+	if _, err := l2.Get(ctx, "k"); err != nil {
+		t.Errorf("Set did not write through to L2: %v", err)
+	}
+
+	// An L1 copy must not outlive l1TTL, so an update in L2 by another node is picked up.
+	now := time.Now().Add(31 * time.Second)
+	l1.now = func() time.Time { return now }
+	l2.Set(ctx, "k", []byte("updated"), time.Hour)
+	if val, _ := tiered.Get(ctx, "k"); string(val) != "updated" {
+		t.Errorf("Get(k) = %q after l1TTL, want the updated L2 value", val)
+	}
+
+	tiered.Delete(ctx, "k")
+	if _, err := tiered.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(k) error = %v after Delete, want ErrMiss", err)
+	}
+}
+
+// taggedMemory stands in for Redis: it returns tags with values, like GetTagged does.
+type taggedMemory struct {
+	*Memory
+	tags map[string][]string
+}
+
+func (m *taggedMemory) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	m.tags[key] = tags
+	return m.Memory.Set(ctx, key, value, ttl, tags...)
+}
+
+func (m *taggedMemory) GetTagged(ctx context.Context, key string) ([]byte, []string, error) {
+	val, err := m.Memory.Get(ctx, key)
+	return val, m.tags[key], err
+}
+
+func TestTieredInvalidateTagsL2Copies(t *testing.T) {
+	ctx := context.Background()
+	l1 := NewMemory(0, 0)
+	l2 := &taggedMemory{Memory: NewMemory(0, 0), tags: make(map[string][]string)}
+	tiered := NewTiered(l1, l2, time.Minute)
+	defer tiered.Close()
+
+	// Written by another node: only in L2, then read into this node's L1.
+	l2.Set(ctx, "stats:se", []byte("v"), time.Hour, Tags("se", DatasetDump)...)
+	if _, err := tiered.Get(ctx, "stats:se"); err != nil {
+		t.Fatalf("Get(stats:se) error = %v", err)
+	}
+
+	// An invalidation announced by another node only reaches this node's L1.
+	l1.Invalidate(ctx, TLDTag("se"))
+	if _, err := l1.Get(ctx, "stats:se"); !errors.Is(err, ErrMiss) {
+		t.Errorf("L1 copy of an L2 hit survived invalidating its tag: %v", err)
+	}
+
+	tiered.Set(ctx, "stats:nu", []byte("v"), time.Hour, Tags("nu", DatasetDump)...)
+	tiered.Invalidate(ctx, DatasetTag("nu", DatasetDump))
+	if _, err := tiered.Get(ctx, "stats:nu"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(stats:nu) error = %v after Invalidate, want ErrMiss", err)
+	}
+}
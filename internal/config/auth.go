@@ -0,0 +1,79 @@
+package config
+
+import "fmt"
+
+// API key backends.
+const (
+	AuthNone  = "none"
+	AuthFile  = "file"
+	AuthMySQL = "mysql"
+)
+
+// Quota counter backends.
+const (
+	QuotaMemory = "memory"
+	QuotaRedis  = "redis"
+)
+
+// Auth configures API key authentication. It is applied at startup.
+type Auth struct {
+	// Backend holds the keys: file (a YAML key list), mysql (an api_keys table) or none, the default.
+	Backend string `yaml:"backend"`
+	// Required rejects requests without a key. Otherwise anonymous requests are served by every
+	// endpoint that does not need a scope, and only keyed requests count against quotas.
+	Required bool `yaml:"required"`
+	// File is the YAML key list of the file backend, re-read on SIGHUP.
+	File string `yaml:"file"`
+	// Database holds the api_keys table of the mysql backend.
+	Database *Database `yaml:"database"`
+	// Quotas keeps request counts in redis, shared by every node and the default when the cache has
+	// a Redis address, or in memory.
+	Quotas string `yaml:"quotas"`
+}
+
+var DefaultAuth = Auth{
+	Backend: AuthNone,
+}
+
+func (c *Config) finalizeAuth() error {
+	if c.Auth.Backend == "" {
+		c.Auth.Backend = AuthNone
+	}
+	switch c.Auth.Backend {
+	case AuthNone:
+		if c.Auth.Required {
+			return fmt.Errorf("keys cannot be required without a key backend")
+		}
+	case AuthFile:
+		if c.Auth.File == "" {
+			return fmt.Errorf("file backend needs a key file")
+		}
+	case AuthMySQL:
+		if c.Auth.Database == nil {
+			return fmt.Errorf("mysql backend needs a database")
+		}
+		c.Auth.Database.ID = "auth"
+		if err := c.finalizeDatabase(c.Auth.Database); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown key backend: %s", c.Auth.Backend)
+	}
+
+	if c.Auth.Quotas == "" {
+		c.Auth.Quotas = QuotaMemory
+		if c.Cache.Redis != "" {
+			c.Auth.Quotas = QuotaRedis
+		}
+	}
+	switch c.Auth.Quotas {
+	case QuotaMemory:
+	case QuotaRedis:
+		if c.Cache.Redis == "" {
+			return fmt.Errorf("redis quotas need a redis address")
+		}
+	default:
+		return fmt.Errorf("unknown quota backend: %s", c.Auth.Quotas)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cache backends.
+const (
+	CacheNone   = "none"
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+	// CacheTiered keeps hot keys in process memory in front of a shared Redis.
+	CacheTiered = "tiered"
+)
+
+// Cache selects and sizes the response cache. It is applied at startup, reloads leave it unchanged.
+type Cache struct {
+	// Backend defaults to redis when Redis is set and to memory otherwise.
+	Backend string `yaml:"backend"`
+	// Redis is the address of the Redis server, defaulting to REDIS_URL.
+	Redis string `yaml:"redis"`
+	// MaxEntries and MaxBytes bound the in-memory cache; zero means unbounded.
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	// L1TTL caps how long the tiered backend keeps a key in memory, and so how stale a node's copy
+	// can be after another node refreshes it.
+	L1TTL time.Duration `yaml:"l1_ttl"`
+	// Watch is how often every dump and diff database is checked for new data, dropping the cached
+	// responses of a dataset once its latest dates row changes; zero disables the check.
+	Watch time.Duration `yaml:"watch"`
+}
+
+var DefaultCache = Cache{
+	MaxEntries: 10000,
+	MaxBytes:   256 << 20,
+	L1TTL:      30 * time.Second,
+	Watch:      time.Minute,
+}
+
+func (c *Config) finalizeCache() error {
+	if c.Cache.Backend == "" {
+		c.Cache.Backend = CacheMemory
+		if c.Cache.Redis != "" {
+			c.Cache.Backend = CacheRedis
+		}
+	}
+	switch c.Cache.Backend {
+	case CacheNone, CacheMemory:
+	case CacheRedis, CacheTiered:
+		if c.Cache.Redis == "" {
+			return fmt.Errorf("cache backend %s needs a redis address", c.Cache.Backend)
+		}
+	default:
+		return fmt.Errorf("unknown cache backend: %s", c.Cache.Backend)
+	}
+	if c.Cache.MaxEntries < 0 || c.Cache.MaxBytes < 0 {
+		return fmt.Errorf("cache limits must not be negative")
+	}
+	if c.Cache.Backend == CacheTiered && c.Cache.L1TTL <= 0 {
+		return fmt.Errorf("cache l1_ttl must be positive")
+	}
+	if c.Cache.Watch < 0 {
+		return fmt.Errorf("cache watch must not be negative")
+	}
+	return nil
+}
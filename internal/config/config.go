@@ -0,0 +1,367 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Endpoint names that can be enabled per TLD.
+const (
+	EndpointDates      = "dates"
+	EndpointDomains    = "domains"
+	EndpointRemoved    = "removed"
+	EndpointSearch     = "search"
+	EndpointStats      = "stats"
+	EndpointAppearance = "appearance"
+	EndpointHistory    = "history"
+	EndpointExport     = "export"
+	EndpointFeeds      = "feeds"
+	EndpointZone       = "zone"
+)
+
+// Endpoints served from the dump database, from the diff database and from both respectively.
+var (
+	dumpEndpoints = []string{EndpointSearch, EndpointStats, EndpointZone}
+	diffEndpoints = []string{EndpointDates, EndpointDomains, EndpointRemoved, EndpointAppearance, EndpointExport, EndpointFeeds}
+	bothEndpoints = []string{EndpointHistory}
+)
+
+var tldPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+type Database struct {
+	// ID identifies the database in the connection pool registry as "<tld>/dump" or "<tld>/diff",
+	// or "auth" for the API key database.
+	ID string `yaml:"-"`
+
+	Host         string `yaml:"host"`
+	Name         string `yaml:"name"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+type TLD struct {
+	DisplayName string    `yaml:"display_name"`
+	Dump        *Database `yaml:"dump"`
+	Diff        *Database `yaml:"diff"`
+	AXFR        *AXFR     `yaml:"axfr"`
+	Endpoints   []string  `yaml:"endpoints"`
+}
+
+// Enabled reports whether the named endpoint is served for this TLD.
+func (t *TLD) Enabled(endpoint string) bool {
+	return slices.Contains(t.Endpoints, endpoint)
+}
+
+// Pool holds the connection pool limits applied to every database.
+type Pool struct {
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// DefaultPool matches the limits dbConn used to apply per request.
+var DefaultPool = Pool{
+	MaxOpenConns:    100,
+	MaxIdleConns:    50,
+	ConnMaxLifetime: time.Hour,
+}
+
+// SearchIndex controls the in-memory trigram index used by /search.
+type SearchIndex struct {
+	Enabled bool `yaml:"enabled"`
+	// Refresh is how often dump databases are checked for new data to rebuild from.
+	Refresh time.Duration `yaml:"refresh"`
+}
+
+var DefaultSearchIndex = SearchIndex{
+	Enabled: true,
+	Refresh: 5 * time.Minute,
+}
+
+type Config struct {
+	// Host is the default MySQL host for databases that do not set their own.
+	// An empty host lets the driver fall back to localhost:3306.
+	Host string `yaml:"host"`
+	// PublicURL is the externally visible base URL of the API, e.g. https://api.example, used for
+	// the absolute links in feeds. Without it links are built from the request's Host header.
+	PublicURL   string          `yaml:"public_url"`
+	Pool        Pool            `yaml:"pool"`
+	SearchIndex SearchIndex     `yaml:"search_index"`
+	Cache       Cache           `yaml:"cache"`
+	Tracing     Tracing         `yaml:"tracing"`
+	Auth        Auth            `yaml:"auth"`
+	RateLimit   RateLimit       `yaml:"rate_limit"`
+	CORS        CORS            `yaml:"cors"`
+	TLDs        map[string]*TLD `yaml:"tlds"`
+}
+
+// Names returns the configured TLDs in sorted order.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.TLDs))
+	for name := range c.TLDs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads a YAML TLD registry from path, resolves secret files and validates it.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	cfg := Config{Pool: DefaultPool, SearchIndex: DefaultSearchIndex, Cache: DefaultCache, Tracing: DefaultTracing, Auth: DefaultAuth, CORS: DefaultCORS}
+	cfg.Cache.Redis = os.Getenv("REDIS_URL")
+	cfg.Tracing.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+
+	if len(cfg.TLDs) == 0 {
+		return nil, fmt.Errorf("invalid config %s: no TLDs configured", path)
+	}
+	if err := cfg.finalize(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// legacyTLDs are the TLDs historically configured through MYSQL_<TLD>DUMP_* and MYSQL_<TLD>_* env vars.
+var legacyTLDs = []string{"se", "nu", "ch", "li", "ee", "sk"}
+
+// FromEnv builds the registry from the legacy environment variables, for deployments without a config file.
+// A TLD is included when its dump or diff database name is set.
+func FromEnv() (*Config, error) {
+	cfg := Config{
+		Host:        os.Getenv("MYSQL_HOSTNAME"),
+		PublicURL:   os.Getenv("PUBLIC_URL"),
+		Pool:        DefaultPool,
+		SearchIndex: DefaultSearchIndex,
+		Cache:       DefaultCache,
+		Tracing:     DefaultTracing,
+		Auth:        DefaultAuth,
+		CORS:        DefaultCORS,
+		TLDs:        make(map[string]*TLD),
+	}
+	cfg.Cache.Backend = os.Getenv("CACHE_BACKEND")
+	cfg.Cache.Redis = os.Getenv("REDIS_URL")
+	cfg.Tracing.Exporter = os.Getenv("TRACING_EXPORTER")
+	cfg.Tracing.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if backend := os.Getenv("AUTH_BACKEND"); backend != "" {
+		cfg.Auth.Backend = backend
+	}
+	cfg.Auth.File = os.Getenv("AUTH_KEYS_FILE")
+	cfg.Auth.Database = envDatabase("MYSQL_AUTH_")
+	cfg.Auth.Quotas = os.Getenv("AUTH_QUOTAS")
+	cfg.RateLimit.Backend = os.Getenv("RATE_LIMIT_BACKEND")
+	cfg.RateLimit.TrustedProxies = envList("RATE_LIMIT_TRUSTED_PROXIES", nil)
+	cfg.CORS.AllowedOrigins = envList("CORS_ALLOWED_ORIGINS", nil)
+	cfg.CORS.AllowedMethods = envList("CORS_ALLOWED_METHODS", cfg.CORS.AllowedMethods)
+	cfg.CORS.AllowedHeaders = envList("CORS_ALLOWED_HEADERS", cfg.CORS.AllowedHeaders)
+	cfg.CORS.ExposedHeaders = envList("CORS_EXPOSED_HEADERS", cfg.CORS.ExposedHeaders)
+
+	var err error
+	if cfg.Pool.MaxOpenConns, err = envInt("MYSQL_MAX_OPEN_CONNS", cfg.Pool.MaxOpenConns); err != nil {
+		return nil, err
+	}
+	if cfg.Pool.MaxIdleConns, err = envInt("MYSQL_MAX_IDLE_CONNS", cfg.Pool.MaxIdleConns); err != nil {
+		return nil, err
+	}
+	if cfg.Pool.ConnMaxLifetime, err = envDuration("MYSQL_CONN_MAX_LIFETIME", cfg.Pool.ConnMaxLifetime); err != nil {
+		return nil, err
+	}
+	if cfg.Pool.ConnMaxIdleTime, err = envDuration("MYSQL_CONN_MAX_IDLE_TIME", cfg.Pool.ConnMaxIdleTime); err != nil {
+		return nil, err
+	}
+	if cfg.SearchIndex.Enabled, err = envBool("SEARCH_INDEX_ENABLED", cfg.SearchIndex.Enabled); err != nil {
+		return nil, err
+	}
+	if cfg.SearchIndex.Refresh, err = envDuration("SEARCH_INDEX_REFRESH", cfg.SearchIndex.Refresh); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.MaxEntries, err = envInt("CACHE_MAX_ENTRIES", cfg.Cache.MaxEntries); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.MaxBytes, err = envInt64("CACHE_MAX_BYTES", cfg.Cache.MaxBytes); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.L1TTL, err = envDuration("CACHE_L1_TTL", cfg.Cache.L1TTL); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.Watch, err = envDuration("CACHE_WATCH", cfg.Cache.Watch); err != nil {
+		return nil, err
+	}
+	if cfg.Auth.Required, err = envBool("AUTH_REQUIRED", cfg.Auth.Required); err != nil {
+		return nil, err
+	}
+	if cfg.Tracing.SampleRatio, err = envFloat("TRACING_SAMPLE_RATIO", cfg.Tracing.SampleRatio); err != nil {
+		return nil, err
+	}
+	if cfg.CORS.AllowCredentials, err = envBool("CORS_ALLOW_CREDENTIALS", cfg.CORS.AllowCredentials); err != nil {
+		return nil, err
+	}
+	if cfg.CORS.MaxAge, err = envDuration("CORS_MAX_AGE", cfg.CORS.MaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Default.PerIP.Rate, err = envFloat("RATE_LIMIT_IP_RATE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Default.PerIP.Burst, err = envInt("RATE_LIMIT_IP_BURST", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Default.PerKey.Rate, err = envFloat("RATE_LIMIT_KEY_RATE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Default.PerKey.Burst, err = envInt("RATE_LIMIT_KEY_BURST", 0); err != nil {
+		return nil, err
+	}
+
+	for _, tld := range legacyTLDs {
+		upper := strings.ToUpper(tld)
+		entry := &TLD{
+			Dump: envDatabase("MYSQL_" + upper + "DUMP_"),
+			Diff: envDatabase("MYSQL_" + upper + "_"),
+		}
+		if entry.Dump != nil || entry.Diff != nil {
+			cfg.TLDs[tld] = entry
+		}
+	}
+
+	if err := cfg.finalize(); err != nil {
+		return nil, fmt.Errorf("invalid environment config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// finalize applies defaults, reads password files and validates the result.
+func (c *Config) finalize() error {
+	if c.Pool.MaxOpenConns < 0 || c.Pool.MaxIdleConns < 0 || c.Pool.ConnMaxLifetime < 0 || c.Pool.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("pool limits must not be negative")
+	}
+	if c.SearchIndex.Enabled && c.SearchIndex.Refresh <= 0 {
+		return fmt.Errorf("search_index refresh must be positive")
+	}
+	if c.PublicURL != "" {
+		c.PublicURL = strings.TrimSuffix(c.PublicURL, "/")
+		u, err := url.Parse(c.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("public_url %q must be a URL such as https://api.example", c.PublicURL)
+		}
+	}
+	if err := c.finalizeCache(); err != nil {
+		return err
+	}
+	if err := c.finalizeTracing(); err != nil {
+		return err
+	}
+	if err := c.finalizeAuth(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if err := c.finalizeRateLimit(); err != nil {
+		return fmt.Errorf("rate_limit: %w", err)
+	}
+	if err := c.finalizeCORS(); err != nil {
+		return fmt.Errorf("cors: %w", err)
+	}
+
+	for _, name := range c.Names() {
+		tld := c.TLDs[name]
+		if tld == nil {
+			return fmt.Errorf("tld %s: empty definition", name)
+		}
+		if !tldPattern.MatchString(name) {
+			return fmt.Errorf("tld %s: name must be lowercase letters, digits or '-'", name)
+		}
+		if tld.Dump == nil && tld.Diff == nil {
+			return fmt.Errorf("tld %s: at least one of dump or diff must be set", name)
+		}
+		if tld.DisplayName == "" {
+			tld.DisplayName = strings.ToUpper(name)
+		}
+
+		if tld.Dump != nil {
+			tld.Dump.ID = name + "/dump"
+			if err := c.finalizeDatabase(tld.Dump); err != nil {
+				return fmt.Errorf("tld %s: dump: %w", name, err)
+			}
+		}
+		if tld.Diff != nil {
+			tld.Diff.ID = name + "/diff"
+			if err := c.finalizeDatabase(tld.Diff); err != nil {
+				return fmt.Errorf("tld %s: diff: %w", name, err)
+			}
+		}
+
+		if tld.AXFR != nil {
+			if err := finalizeAXFR(name, tld); err != nil {
+				return fmt.Errorf("tld %s: axfr: %w", name, err)
+			}
+		}
+
+		if tld.Endpoints == nil {
+			if tld.Dump != nil {
+				tld.Endpoints = append(tld.Endpoints, dumpEndpoints...)
+			}
+			if tld.Diff != nil {
+				tld.Endpoints = append(tld.Endpoints, diffEndpoints...)
+			}
+			if tld.Dump != nil && tld.Diff != nil {
+				tld.Endpoints = append(tld.Endpoints, bothEndpoints...)
+			}
+		}
+		for _, endpoint := range tld.Endpoints {
+			switch {
+			case slices.Contains(dumpEndpoints, endpoint):
+				if tld.Dump == nil {
+					return fmt.Errorf("tld %s: endpoint %s requires a dump database", name, endpoint)
+				}
+			case slices.Contains(diffEndpoints, endpoint):
+				if tld.Diff == nil {
+					return fmt.Errorf("tld %s: endpoint %s requires a diff database", name, endpoint)
+				}
+			case slices.Contains(bothEndpoints, endpoint):
+				if tld.Dump == nil || tld.Diff == nil {
+					return fmt.Errorf("tld %s: endpoint %s requires both a dump and a diff database", name, endpoint)
+				}
+			default:
+				return fmt.Errorf("tld %s: unknown endpoint %q", name, endpoint)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) finalizeDatabase(db *Database) error {
+	if db.Name == "" {
+		return fmt.Errorf("database name is required")
+	}
+	if db.Host == "" {
+		db.Host = c.Host
+	}
+	if db.PasswordFile != "" {
+		if db.Password != "" {
+			return fmt.Errorf("password and password_file are mutually exclusive")
+		}
+		secret, err := os.ReadFile(db.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("reading password file: %w", err)
+		}
+		db.Password = strings.TrimRight(string(secret), "\r\n")
+	}
+	return nil
+}
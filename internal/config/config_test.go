@@ -0,0 +1,374 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	dir := t.TempDir()
+	secret := writeFile(t, dir, "secret", "s3cret\n")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid config",
+			content: `
+host: db.example:3306
+public_url: https://api.example/
+pool:
+  max_open_conns: 10
+  conn_max_idle_time: 5m
+search_index: {refresh: 1m}
+cors:
+  allowed_origins: [https://App.example/, "https://*.partner.example"]
+  allowed_methods: [get]
+rate_limit:
+  trusted_proxies: [10.0.0.0/8, 192.0.2.1]
+  routes:
+    /search/: {per_ip: {rate: 0.5}, per_key: {rate: 5, burst: 20}}
+tlds:
+  se:
+    display_name: Sweden
+    dump: {name: sedump, username: se, password_file: ` + secret + `}
+    diff: {name: sediff, username: se, password: pass, host: other:3306}
+  nu:
+    dump: {name: nudump}
+    diff: {name: nudiff}
+    axfr: {server: zonedata.iis.se:53, zone: nu}
+  ch:
+    dump: {name: chdump, username: ch, password: pass}
+    endpoints: [search]
+`,
+		},
+		{
+			name:    "negative pool limit",
+			content: "pool: {max_idle_conns: -1}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "zero search index refresh",
+			content: "search_index: {refresh: 0s}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "refresh must be positive",
+		},
+		{
+			name:    "tiered cache without redis",
+			content: "cache: {backend: tiered}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "needs a redis address",
+		},
+		{
+			name:    "unknown cache backend",
+			content: "cache: {backend: memcached, redis: r:6379}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "unknown cache backend",
+		},
+		{
+			name:    "otlp tracing without endpoint",
+			content: "tracing: {exporter: otlp}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "needs an endpoint",
+		},
+		{
+			name:    "tracing endpoint without scheme",
+			content: "tracing: {endpoint: collector:4318}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "must be a URL",
+		},
+		{
+			name:    "required keys without backend",
+			content: "auth: {required: true}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "cannot be required without a key backend",
+		},
+		{
+			name:    "mysql keys without database",
+			content: "auth: {backend: mysql}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "needs a database",
+		},
+		{
+			name:    "redis rate limits without redis",
+			content: "rate_limit: {backend: redis}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "needs a redis address",
+		},
+		{
+			name:    "invalid trusted proxy",
+			content: "rate_limit: {trusted_proxies: [10.0.0.0/33]}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "neither a CIDR nor an address",
+		},
+		{
+			name:    "negative rate",
+			content: "rate_limit: {routes: {/search/: {per_ip: {rate: -1}}}}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "route /search/: rate and burst must not be negative",
+		},
+		{
+			name:    "rate limit route without slash",
+			content: "rate_limit: {routes: {search: {per_ip: {rate: 1}}}}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "must be a path pattern",
+		},
+		{
+			name:    "credentials for any origin",
+			content: "cors: {allowed_origins: ['*'], allow_credentials: true}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "cannot be allowed for the * origin",
+		},
+		{
+			name:    "origin without scheme",
+			content: "cors: {allowed_origins: [app.example]}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "must look like https://app.example",
+		},
+		{
+			name:    "wildcard in the middle of an origin",
+			content: "cors: {allowed_origins: ['https://app.*.example']}\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "only use * for the leftmost subdomain",
+		},
+		{
+			name:    "relative public url",
+			content: "public_url: /api\ntlds:\n  se:\n    dump: {name: sedump}\n",
+			wantErr: "must be a URL such as https://api.example",
+		},
+		{
+			name:    "no TLDs",
+			content: "host: db.example\n",
+			wantErr: "no TLDs configured",
+		},
+		{
+			name:    "unknown field",
+			content: "tlds:\n  se:\n    dump: {name: sedump, databse: x}\n",
+			wantErr: "field databse not found",
+		},
+		{
+			name:    "missing databases",
+			content: "tlds:\n  se:\n    display_name: Sweden\n",
+			wantErr: "at least one of dump or diff",
+		},
+		{
+			name:    "missing database name",
+			content: "tlds:\n  se:\n    dump: {username: se}\n",
+			wantErr: "database name is required",
+		},
+		{
+			name:    "diff endpoint without diff database",
+			content: "tlds:\n  se:\n    dump: {name: sedump}\n    endpoints: [dates]\n",
+			wantErr: "requires a diff database",
+		},
+		{
+			name:    "history without dump database",
+			content: "tlds:\n  se:\n    diff: {name: sediff}\n    endpoints: [history]\n",
+			wantErr: "requires both a dump and a diff database",
+		},
+		{
+			name:    "axfr without server",
+			content: "tlds:\n  se:\n    dump: {name: sedump}\n    diff: {name: sediff}\n    axfr: {zone: se.}\n",
+			wantErr: "server is required",
+		},
+		{
+			name:    "axfr across hosts",
+			content: "tlds:\n  se:\n    dump: {name: sedump, host: a}\n    diff: {name: sediff, host: b}\n    axfr: {server: 127.0.0.1:53}\n",
+			wantErr: "must be on the same host",
+		},
+		{
+			name:    "unknown endpoint",
+			content: "tlds:\n  se:\n    dump: {name: sedump}\n    endpoints: [archive]\n",
+			wantErr: `unknown endpoint "archive"`,
+		},
+		{
+			name:    "invalid TLD name",
+			content: "tlds:\n  SE:\n    dump: {name: sedump}\n",
+			wantErr: "name must be lowercase",
+		},
+		{
+			name:    "password and password file",
+			content: "tlds:\n  se:\n    dump: {name: sedump, password: x, password_file: " + secret + "}\n",
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "missing password file",
+			content: "tlds:\n  se:\n    dump: {name: sedump, password_file: " + filepath.Join(dir, "nope") + "}\n",
+			wantErr: "reading password file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, dir, "tlds.yaml", tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.Pool.MaxOpenConns != 10 || cfg.Pool.MaxIdleConns != DefaultPool.MaxIdleConns || cfg.Pool.ConnMaxIdleTime != 5*time.Minute {
+				t.Errorf("pool = %+v, want overrides merged with defaults", cfg.Pool)
+			}
+			if !cfg.SearchIndex.Enabled || cfg.SearchIndex.Refresh != time.Minute {
+				t.Errorf("search index = %+v, want enabled with 1m refresh", cfg.SearchIndex)
+			}
+			if cfg.Cache.Backend != CacheMemory || cfg.Cache.MaxEntries != DefaultCache.MaxEntries {
+				t.Errorf("cache = %+v, want the default memory cache without redis", cfg.Cache)
+			}
+			if cfg.Auth.Backend != AuthNone || cfg.Auth.Quotas != QuotaMemory {
+				t.Errorf("auth = %+v, want no keys and memory quotas", cfg.Auth)
+			}
+			search := cfg.RateLimit.Routes["/search/"]
+			if cfg.RateLimit.Backend != RateLimitMemory || search.PerIP != (Limit{Rate: 0.5, Burst: 1}) || search.PerKey != (Limit{Rate: 5, Burst: 20}) {
+				t.Errorf("rate limit = %+v, want memory buckets with the burst defaulted", cfg.RateLimit)
+			}
+			if strings.Join(cfg.CORS.AllowedOrigins, " ") != "https://app.example https://*.partner.example" ||
+				strings.Join(cfg.CORS.AllowedMethods, " ") != "GET" || cfg.CORS.MaxAge != DefaultCORS.MaxAge {
+				t.Errorf("cors = %+v, want normalized origins and methods with the default max age", cfg.CORS)
+			}
+			if cfg.PublicURL != "https://api.example" {
+				t.Errorf("public url = %q, want it without the trailing slash", cfg.PublicURL)
+			}
+			if cfg.Tracing.Exporter != TracingNone || cfg.Tracing.SampleRatio != 1 {
+				t.Errorf("tracing = %+v, want no exporter without an endpoint", cfg.Tracing)
+			}
+
+			se := cfg.TLDs["se"]
+			if se.Dump.ID != "se/dump" || se.Diff.ID != "se/diff" {
+				t.Errorf("se database IDs = %q, %q", se.Dump.ID, se.Diff.ID)
+			}
+			if se.Dump.Password != "s3cret" {
+				t.Errorf("se dump password = %q, want secret file contents", se.Dump.Password)
+			}
+			if se.Dump.Host != "db.example:3306" {
+				t.Errorf("se dump host = %q, want default host", se.Dump.Host)
+			}
+			if se.Diff.Host != "other:3306" {
+				t.Errorf("se diff host = %q, want explicit host", se.Diff.Host)
+			}
+			if !se.Enabled(EndpointDates) || !se.Enabled(EndpointSearch) || !se.Enabled(EndpointHistory) {
+				t.Errorf("se endpoints = %v, want all endpoints by default", se.Endpoints)
+			}
+
+			nu := cfg.TLDs["nu"]
+			if nu.AXFR.Zone != "nu." || nu.AXFR.Timeout != 10*time.Minute {
+				t.Errorf("nu axfr = %+v, want fqdn zone and default timeout", nu.AXFR)
+			}
+
+			ch := cfg.TLDs["ch"]
+			if ch.DisplayName != "CH" {
+				t.Errorf("ch display name = %q, want CH", ch.DisplayName)
+			}
+			if ch.Enabled(EndpointStats) {
+				t.Errorf("ch endpoints = %v, want only search", ch.Endpoints)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("MYSQL_HOSTNAME", "db.example")
+	t.Setenv("MYSQL_NUDUMP_DATABASE", "nudump")
+	t.Setenv("MYSQL_NU_DATABASE", "nudiff")
+	t.Setenv("MYSQL_NU_USERNAME", "nu")
+	t.Setenv("MYSQL_LI_DATABASE", "lidiff")
+	t.Setenv("MYSQL_MAX_OPEN_CONNS", "20")
+	t.Setenv("MYSQL_CONN_MAX_LIFETIME", "30m")
+	t.Setenv("REDIS_URL", "redis:6379")
+	t.Setenv("CACHE_BACKEND", "")
+	t.Setenv("CACHE_MAX_ENTRIES", "5")
+	t.Setenv("TRACING_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("RATE_LIMIT_BACKEND", "")
+	t.Setenv("RATE_LIMIT_TRUSTED_PROXIES", "10.0.0.0/8,fd00::/8")
+	t.Setenv("RATE_LIMIT_IP_RATE", "2")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example, https://*.app.example")
+	t.Setenv("CORS_MAX_AGE", "1h")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v", err)
+	}
+
+	if cfg.Pool.MaxOpenConns != 20 || cfg.Pool.ConnMaxLifetime != 30*time.Minute || cfg.Pool.MaxIdleConns != DefaultPool.MaxIdleConns {
+		t.Errorf("FromEnv() pool = %+v", cfg.Pool)
+	}
+	if cfg.Cache.Backend != CacheRedis || cfg.Cache.Redis != "redis:6379" || cfg.Cache.MaxEntries != 5 {
+		t.Errorf("FromEnv() cache = %+v, want redis from REDIS_URL", cfg.Cache)
+	}
+	if cfg.Tracing.Exporter != TracingOTLP || cfg.Tracing.Endpoint != "http://collector:4318" {
+		t.Errorf("FromEnv() tracing = %+v, want otlp from OTEL_EXPORTER_OTLP_ENDPOINT", cfg.Tracing)
+	}
+	if cfg.RateLimit.Backend != RateLimitRedis || len(cfg.RateLimit.TrustedProxies) != 2 || cfg.RateLimit.Default.PerIP != (Limit{Rate: 2, Burst: 2}) {
+		t.Errorf("FromEnv() rate limit = %+v, want redis buckets limiting every route per IP", cfg.RateLimit)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://*.app.example" || cfg.CORS.MaxAge != time.Hour ||
+		len(cfg.CORS.AllowedHeaders) != len(DefaultCORS.AllowedHeaders) {
+		t.Errorf("FromEnv() cors = %+v, want origins from CORS_ALLOWED_ORIGINS and default headers", cfg.CORS)
+	}
+	if got := strings.Join(cfg.Names(), ","); got != "li,nu" {
+		t.Fatalf("FromEnv() TLDs = %s, want li,nu", got)
+	}
+	nu := cfg.TLDs["nu"]
+	if nu.Dump.Name != "nudump" || nu.Diff.Name != "nudiff" || nu.Diff.Username != "nu" {
+		t.Errorf("FromEnv() nu = %+v / %+v", nu.Dump, nu.Diff)
+	}
+	if nu.Diff.Host != "db.example" {
+		t.Errorf("FromEnv() nu host = %q, want MYSQL_HOSTNAME", nu.Diff.Host)
+	}
+	if li := cfg.TLDs["li"]; li.Dump != nil || li.Enabled(EndpointSearch) || !li.Enabled(EndpointDates) {
+		t.Errorf("FromEnv() li = %+v, want diff-only endpoints", li)
+	}
+}
+
+func TestRegistryReloadOnSignal(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "tlds.yaml", "tlds:\n  se:\n    dump: {name: sedump}\n")
+
+	registry, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	stop := registry.ReloadOnSignal(syscall.SIGHUP)
+	defer stop()
+	reloaded := make(chan *Config, 1)
+	registry.OnReload(func(cfg *Config) { reloaded <- cfg })
+
+	// An invalid file must not replace the active config.
+	writeFile(t, filepath.Dir(path), "tlds.yaml", "tlds:\n  se: {}\n")
+	if err := registry.Reload(); err == nil {
+		t.Fatal("Reload() of invalid config succeeded")
+	}
+	if _, ok := registry.Lookup("se"); !ok {
+		t.Fatal("Lookup(se) failed after rejected reload")
+	}
+	if len(reloaded) != 0 {
+		t.Fatal("OnReload hook called for a rejected reload")
+	}
+
+	writeFile(t, filepath.Dir(path), "tlds.yaml", "tlds:\n  se:\n    dump: {name: sedump}\n  ee:\n    dump: {name: eedump}\n")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("sending SIGHUP: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := registry.Lookup("ee"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("registry was not reloaded on SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cfg := <-reloaded; cfg != registry.Config() {
+		t.Error("OnReload hook not called with the new config")
+	}
+}
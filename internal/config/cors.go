@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CORS configures cross-origin requests. It is applied at startup; without allowed origins no CORS
+// headers are sent.
+type CORS struct {
+	// AllowedOrigins are exact origins such as https://app.example, wildcard subdomains such as
+	// https://*.example, or "*" for any origin.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders are the request headers clients may send; "*" allows any.
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	// AllowCredentials lets browsers send cookies and authorization headers; it cannot be combined
+	// with the "*" origin.
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+var DefaultCORS = CORS{
+	AllowedMethods: []string{"GET", "HEAD", "POST"},
+	AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID"},
+	ExposedHeaders: []string{"X-Request-ID", "X-Cache", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+	MaxAge:         10 * time.Minute,
+}
+
+func (c *Config) finalizeCORS() error {
+	// The lists are rebuilt rather than normalized in place, since they may share DefaultCORS's arrays.
+	origins := make([]string, 0, len(c.CORS.AllowedOrigins))
+	for _, origin := range c.CORS.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		origins = append(origins, origin)
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				return fmt.Errorf("credentials cannot be allowed for the * origin")
+			}
+			continue
+		}
+		scheme, host, ok := strings.Cut(origin, "://")
+		if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#") {
+			return fmt.Errorf("origin %q must look like https://app.example", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("origin %q may only use * for the leftmost subdomain", origin)
+		}
+	}
+	c.CORS.AllowedOrigins = origins
+
+	methods := make([]string, 0, len(c.CORS.AllowedMethods))
+	for _, method := range c.CORS.AllowedMethods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	c.CORS.AllowedMethods = methods
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AXFR describes where the ingestion pipeline transfers a TLD's zone from.
+type AXFR struct {
+	// Server is the host:port of an authoritative server that allows zone transfers.
+	Server string `yaml:"server"`
+	// Zone defaults to "<tld>.".
+	Zone    string        `yaml:"zone"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// finalizeAXFR validates ingestion settings. Ingestion replaces the dump and writes the diff in a
+// single transaction, so both databases must live on the same MySQL server.
+func finalizeAXFR(name string, tld *TLD) error {
+	if tld.AXFR.Server == "" {
+		return fmt.Errorf("server is required")
+	}
+	if tld.AXFR.Zone == "" {
+		tld.AXFR.Zone = name + "."
+	}
+	if !strings.HasSuffix(tld.AXFR.Zone, ".") {
+		tld.AXFR.Zone += "."
+	}
+	if tld.AXFR.Timeout == 0 {
+		tld.AXFR.Timeout = 10 * time.Minute
+	}
+	if tld.Dump == nil || tld.Diff == nil {
+		return fmt.Errorf("requires both a dump and a diff database")
+	}
+	if tld.Dump.Host != tld.Diff.Host {
+		return fmt.Errorf("dump and diff databases must be on the same host")
+	}
+	if strings.Contains(tld.Dump.Name, "`") || strings.Contains(tld.Diff.Name, "`") {
+		return fmt.Errorf("database names must not contain backticks")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+)
+
+// Rate limiter backends.
+const (
+	RateLimitMemory = "memory"
+	RateLimitRedis  = "redis"
+)
+
+// Limit is a token bucket of Burst requests refilled at Rate requests per second. The zero Limit
+// does not limit.
+type Limit struct {
+	Rate float64 `yaml:"rate"`
+	// Burst defaults to the requests of one second, at least one.
+	Burst int `yaml:"burst"`
+}
+
+// RouteLimit limits a route. Anonymous requests draw from a bucket per client IP and keyed
+// requests from a bucket per API key.
+type RouteLimit struct {
+	PerIP  Limit `yaml:"per_ip"`
+	PerKey Limit `yaml:"per_key"`
+}
+
+// RateLimit configures request rate limiting. It is applied at startup.
+type RateLimit struct {
+	// Backend keeps buckets in redis, shared by every node and the default when the cache has a Redis
+	// address, or in memory. Redis falls back to memory while it is unreachable.
+	Backend string `yaml:"backend"`
+	// TrustedProxies are the CIDRs whose X-Forwarded-For header names the client.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Default limits routes missing from Routes.
+	Default RouteLimit `yaml:"default"`
+	// Routes limits routes by their pattern, e.g. "/search/".
+	Routes map[string]RouteLimit `yaml:"routes"`
+}
+
+func (c *Config) finalizeRateLimit() error {
+	if c.RateLimit.Backend == "" {
+		c.RateLimit.Backend = RateLimitMemory
+		if c.Cache.Redis != "" {
+			c.RateLimit.Backend = RateLimitRedis
+		}
+	}
+	switch c.RateLimit.Backend {
+	case RateLimitMemory:
+	case RateLimitRedis:
+		if c.Cache.Redis == "" {
+			return fmt.Errorf("redis backend needs a redis address")
+		}
+	default:
+		return fmt.Errorf("unknown backend: %s", c.RateLimit.Backend)
+	}
+
+	for _, proxy := range c.RateLimit.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				return fmt.Errorf("trusted proxy %q is neither a CIDR nor an address", proxy)
+			}
+		}
+	}
+
+	if err := finalizeRouteLimit(&c.RateLimit.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for route, limit := range c.RateLimit.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("route %q must be a path pattern such as /search/", route)
+		}
+		if err := finalizeRouteLimit(&limit); err != nil {
+			return fmt.Errorf("route %s: %w", route, err)
+		}
+		c.RateLimit.Routes[route] = limit
+	}
+	return nil
+}
+
+func finalizeRouteLimit(limit *RouteLimit) error {
+	for _, l := range []*Limit{&limit.PerIP, &limit.PerKey} {
+		if l.Rate < 0 || l.Burst < 0 {
+			return fmt.Errorf("rate and burst must not be negative")
+		}
+		if l.Rate > 0 && l.Burst == 0 {
+			l.Burst = max(1, int(math.Ceil(l.Rate)))
+		}
+	}
+	return nil
+}
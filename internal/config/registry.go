@@ -0,0 +1,104 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds the active TLD configuration and swaps it atomically on reload.
+type Registry struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mu       sync.Mutex
+	onReload []func(*Config)
+}
+
+// NewRegistry wraps an already loaded configuration. Reload re-reads the legacy env vars.
+func NewRegistry(cfg *Config) *Registry {
+	r := &Registry{}
+	r.current.Store(cfg)
+	return r
+}
+
+// Open loads the registry from path, or from the legacy env vars when path is empty.
+func Open(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Config returns the active configuration. Callers must not modify it.
+func (r *Registry) Config() *Config {
+	return r.current.Load()
+}
+
+// Lookup returns the configuration for a TLD.
+func (r *Registry) Lookup(tld string) (*TLD, bool) {
+	entry, ok := r.Config().TLDs[tld]
+	return entry, ok
+}
+
+// Reload re-reads the configuration source. On error the previous configuration stays active.
+func (r *Registry) Reload() error {
+	var (
+		cfg *Config
+		err error
+	)
+	if r.path != "" {
+		cfg, err = Load(r.path)
+	} else {
+		cfg, err = FromEnv()
+	}
+	if err != nil {
+		return err
+	}
+	r.current.Store(cfg)
+
+	r.mu.Lock()
+	hooks := r.onReload
+	r.mu.Unlock()
+	for _, fn := range hooks {
+		fn(cfg)
+	}
+	return nil
+}
+
+// OnReload registers fn to be called with the new configuration after every successful reload.
+func (r *Registry) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// ReloadOnSignal reloads the registry every time one of sig is received until stop is called.
+func (r *Registry) ReloadOnSignal(sig ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case s := <-ch:
+				if err := r.Reload(); err != nil {
+					slog.Error("TLD config reload failed, keeping previous config", slog.String("signal", s.String()), slog.Any("error", err))
+					continue
+				}
+				slog.Info("TLD config reloaded", slog.String("signal", s.String()), slog.Int("tlds", len(r.Config().TLDs)))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Trace exporters.
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// Tracing selects where OpenTelemetry traces are exported. It is applied at startup.
+type Tracing struct {
+	// Exporter defaults to otlp when Endpoint is set and to none otherwise. stdout prints spans for
+	// local debugging.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://collector:4318, defaulting to
+	// OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the fraction of new traces recorded; requests with a sampled parent are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+var DefaultTracing = Tracing{
+	SampleRatio: 1,
+}
+
+func (c *Config) finalizeTracing() error {
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = TracingNone
+		if c.Tracing.Endpoint != "" {
+			c.Tracing.Exporter = TracingOTLP
+		}
+	}
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.Tracing.Endpoint == "" {
+			return fmt.Errorf("tracing exporter otlp needs an endpoint")
+		}
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("tracing endpoint %q must be a URL such as http://collector:4318", c.Tracing.Endpoint)
+		}
+	default:
+		return fmt.Errorf("unknown tracing exporter: %s", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
@@ -7,8 +7,11 @@ import (
 )
 
 func Connect(dbName string, dbUser string, dbPass string) (db *sql.DB, err error) {
+	return ConnectTo(os.Getenv("MYSQL_HOSTNAME"), dbName, dbUser, dbPass)
+}
+
+func ConnectTo(mysqlHostname string, dbName string, dbUser string, dbPass string) (db *sql.DB, err error) {
 	dbDriver := "mysql"
-	mysqlHostname := os.Getenv("MYSQL_HOSTNAME")
 	db, err = sql.Open(dbDriver, dbUser+":"+dbPass+"@tcp"+"("+mysqlHostname+")"+"/"+dbName)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-axfr-backend/internal/config"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultDrainDelay is how long a replaced pool stays open for the requests that already got it.
+const DefaultDrainDelay = 2 * time.Minute
+
+// Pools is a registry of long-lived connection pools, created lazily on first use and shared by
+// all handlers. A pool is keyed by config.Database.ID and replaced when its DSN or limits change,
+// e.g. after a TLD registry reload.
+type Pools struct {
+	// DrainDelay is how long a replaced pool is kept open before it is closed, so handlers that
+	// got it before the reload can finish their queries on it.
+	DrainDelay time.Duration
+
+	mu    sync.Mutex
+	pools map[string]*pool
+	// retired holds the replaced pools still draining, with the timers that close them.
+	retired map[*sql.DB]*time.Timer
+	closed  bool
+	// driver is the database/sql driver name, replaced in tests.
+	driver string
+}
+
+type pool struct {
+	dsn    string
+	limits config.Pool
+	db     *sql.DB
+}
+
+var ErrPoolsClosed = errors.New("connection pools are closed")
+
+func NewPools() *Pools {
+	return &Pools{
+		DrainDelay: DefaultDrainDelay,
+		pools:      make(map[string]*pool),
+		retired:    make(map[*sql.DB]*time.Timer),
+		driver:     "mysql",
+	}
+}
+
+// DSN builds the MySQL data source name for a configured database.
+func DSN(cfg config.Database) string {
+	return cfg.Username + ":" + cfg.Password + "@tcp" + "(" + cfg.Host + ")" + "/" + cfg.Name
+}
+
+// Get returns the shared pool for cfg, opening and pinging it on first use.
+func (p *Pools) Get(ctx context.Context, cfg config.Database, limits config.Pool) (*sql.DB, error) {
+	dsn := DSN(cfg)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolsClosed
+	}
+	if existing, ok := p.pools[cfg.ID]; ok && existing.dsn == dsn && existing.limits == limits {
+		p.mu.Unlock()
+		return existing.db, nil
+	}
+	p.mu.Unlock()
+
+	// Open outside the lock so a slow database does not block requests for the others.
+	ctx, span := tracer.Start(ctx, "db.pool.open", trace.WithAttributes(
+		semconv.DBSystemNameMySQL, semconv.DBNamespace(cfg.Name), attribute.String("db.pool.id", cfg.ID)))
+	defer span.End()
+
+	db, err := sql.Open(p.driver, dsn)
+	if err != nil {
+		fail(span, err)
+		return nil, err
+	}
+	db.SetMaxOpenConns(limits.MaxOpenConns)
+	db.SetMaxIdleConns(limits.MaxIdleConns)
+	db.SetConnMaxLifetime(limits.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(limits.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		fail(span, err)
+		db.Close()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		db.Close()
+		return nil, ErrPoolsClosed
+	}
+	if existing, ok := p.pools[cfg.ID]; ok {
+		if existing.dsn == dsn && existing.limits == limits {
+			// Another request opened the same pool first.
+			db.Close()
+			return existing.db, nil
+		}
+		p.retire(existing.db)
+	}
+	p.pools[cfg.ID] = &pool{dsn: dsn, limits: limits, db: db}
+	return db, nil
+}
+
+// retire closes a replaced pool after DrainDelay. Closing it at once would fail the next query
+// of every handler still holding it with "sql: database is closed". p.mu must be held.
+func (p *Pools) retire(db *sql.DB) {
+	p.retired[db] = time.AfterFunc(p.DrainDelay, func() {
+		p.mu.Lock()
+		delete(p.retired, db)
+		p.mu.Unlock()
+		db.Close()
+	})
+}
+
+// Prune retires every pool whose ID is not in active, such as those of a TLD removed from the
+// registry, and returns their IDs.
+func (p *Pools) Prune(active map[string]bool) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var pruned []string
+	for id, pl := range p.pools {
+		if active[id] {
+			continue
+		}
+		p.retire(pl.db)
+		delete(p.pools, id)
+		pruned = append(pruned, id)
+	}
+	slices.Sort(pruned)
+	return pruned
+}
+
+// Stats is the JSON view of sql.DBStats for one pool.
+type Stats struct {
+	MaxOpenConnections int           `json:"max_open_connections"`
+	OpenConnections    int           `json:"open_connections"`
+	InUse              int           `json:"in_use"`
+	Idle               int           `json:"idle"`
+	WaitCount          int64         `json:"wait_count"`
+	WaitDuration       time.Duration `json:"wait_duration_ns"`
+	MaxIdleClosed      int64         `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64         `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
+}
+
+// Stats returns the statistics of every open pool keyed by database ID.
+func (p *Pools) Stats() map[string]Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make(map[string]Stats, len(p.pools))
+	for id, pl := range p.pools {
+		s := pl.db.Stats()
+		stats[id] = Stats{
+			MaxOpenConnections: s.MaxOpenConnections,
+			OpenConnections:    s.OpenConnections,
+			InUse:              s.InUse,
+			Idle:               s.Idle,
+			WaitCount:          s.WaitCount,
+			WaitDuration:       s.WaitDuration,
+			MaxIdleClosed:      s.MaxIdleClosed,
+			MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  s.MaxLifetimeClosed,
+		}
+	}
+	return stats
+}
+
+// Close closes every pool, including replaced ones still draining. Later calls to Get fail with
+// ErrPoolsClosed.
+func (p *Pools) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, pl := range p.pools {
+		if err := pl.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for db, timer := range p.retired {
+		if timer.Stop() {
+			if err := db.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	p.pools = make(map[string]*pool)
+	p.retired = make(map[*sql.DB]*time.Timer)
+	p.closed = true
+	return errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"go-axfr-backend/internal/config"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDSN(t *testing.T) {
+	got := DSN(config.Database{Host: "db:3306", Name: "nudiff", Username: "user", Password: "pass"})
+	if want := "user:pass@tcp(db:3306)/nudiff"; got != want {
+		t.Errorf("DSN() = %v, want %v", got, want)
+	}
+}
+
+func TestPoolsGet(t *testing.T) {
+	pools := NewPools()
+	unreachable := config.Database{ID: "nu/diff", Host: "127.0.0.1:1", Name: "nudiff", Username: "user", Password: "pass"}
+
+	if _, err := pools.Get(context.Background(), unreachable, config.DefaultPool); err == nil {
+		t.Fatal("Get() on unreachable database succeeded")
+	}
+	if stats := pools.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() = %v, failed pools must not be registered", stats)
+	}
+
+	if err := pools.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := pools.Get(context.Background(), unreachable, config.DefaultPool); !errors.Is(err, ErrPoolsClosed) {
+		t.Errorf("Get() after Close() error = %v, want ErrPoolsClosed", err)
+	}
+}
+
+// fakeDriver serves every query with one row holding 1, so pools can be tested without MySQL.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return &fakeRows{}, nil }
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Columns() []string { return []string{"n"} }
+func (*fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("pooltest", fakeDriver{})
+}
+
+func TestPoolsReloadDrainsReplacedPool(t *testing.T) {
+	pools := NewPools()
+	pools.driver = "pooltest"
+	pools.DrainDelay = 50 * time.Millisecond
+	defer pools.Close()
+	ctx := context.Background()
+	cfg := config.Database{ID: "se/dump", Host: "db:3306", Name: "sedump"}
+
+	old, err := pools.Get(ctx, cfg, config.DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A handler is reading from the old pool when the registry is reloaded with a new host.
+	rows, err := Query(ctx, old, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Host = "replica:3306"
+	current, err := pools.Get(ctx, cfg, config.DefaultPool)
+	if err != nil || current == old {
+		t.Fatalf("Get() after reload = %p, %v, want a new pool", current, err)
+	}
+
+	// The running query finishes and the handler's next query still works on the old pool.
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("closing rows of the running query: %v", err)
+	}
+	var n int
+	if err := QueryRow(ctx, old, "SELECT 1").Scan(&n); err != nil {
+		t.Errorf("query on the replaced pool during the drain delay: %v", err)
+	}
+
+	time.Sleep(pools.DrainDelay + 50*time.Millisecond)
+	if err := old.PingContext(ctx); err == nil || !strings.Contains(err.Error(), "database is closed") {
+		t.Errorf("replaced pool after the drain delay: ping error = %v, want closed", err)
+	}
+	if err := current.PingContext(ctx); err != nil {
+		t.Errorf("current pool: %v", err)
+	}
+}
+
+func TestPoolsPruneRetiresRemovedPools(t *testing.T) {
+	pools := NewPools()
+	pools.driver = "pooltest"
+	pools.DrainDelay = 50 * time.Millisecond
+	defer pools.Close()
+	ctx := context.Background()
+
+	se, err := pools.Get(ctx, config.Database{ID: "se/dump", Host: "db:3306", Name: "sedump"}, config.DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nu, err := pools.Get(ctx, config.Database{ID: "nu/dump", Host: "db:3306", Name: "nudump"}, config.DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nu was removed from the registry.
+	if pruned := pools.Prune(map[string]bool{"se/dump": true}); len(pruned) != 1 || pruned[0] != "nu/dump" {
+		t.Errorf("Prune() = %v, want [nu/dump]", pruned)
+	}
+	if stats := pools.Stats(); len(stats) != 1 {
+		t.Errorf("Stats() after Prune() = %v, want only se/dump", stats)
+	}
+	if err := nu.PingContext(ctx); err != nil {
+		t.Errorf("pruned pool during the drain delay: %v", err)
+	}
+
+	time.Sleep(pools.DrainDelay + 50*time.Millisecond)
+	if err := nu.PingContext(ctx); err == nil || !strings.Contains(err.Error(), "database is closed") {
+		t.Errorf("pruned pool after the drain delay: ping error = %v, want closed", err)
+	}
+	if err := se.PingContext(ctx); err != nil {
+		t.Errorf("active pool: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go-axfr-backend/internal/database")
+
+// Rows is a sql.Rows whose query span ends on Close, recording how many rows were read.
+type Rows struct {
+	*sql.Rows
+	conn *sql.Conn
+	span trace.Span
+	n    int
+	done bool
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		r.n++
+		return true
+	}
+	return false
+}
+
+// Close closes the rows, returns the connection to the pool and ends the query span. It may be
+// called more than once.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if r.done {
+		return err
+	}
+	r.done = true
+	r.conn.Close()
+	r.span.SetAttributes(semconv.DBResponseReturnedRows(r.n))
+	if rowsErr := r.Rows.Err(); rowsErr != nil {
+		fail(r.span, rowsErr)
+	}
+	r.span.End()
+	return err
+}
+
+// Query runs query on a connection acquired from db. The acquisition and the query are traced as
+// separate spans, the query span carries the statement with its placeholders and the row count.
+func Query(ctx context.Context, db *sql.DB, query string, args ...any) (*Rows, error) {
+	conn, err := acquire(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameMySQL, semconv.DBQueryText(query)))
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		fail(span, err)
+		span.End()
+		conn.Close()
+		return nil, err
+	}
+	return &Rows{Rows: rows, conn: conn, span: span}, nil
+}
+
+// Row is the result of QueryRow.
+type Row struct {
+	rows *Rows
+	err  error
+}
+
+// QueryRow is Query for statements returning at most one row, like sql.DB.QueryRow.
+func QueryRow(ctx context.Context, db *sql.DB, query string, args ...any) *Row {
+	rows, err := Query(ctx, db, query, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// Scan copies the first row into dest and closes the query, or returns sql.ErrNoRows.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	return r.rows.Close()
+}
+
+// acquire takes a connection from db's pool, dialing a new one when none is idle.
+func acquire(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	ctx, span := tracer.Start(ctx, "db.conn", trace.WithAttributes(semconv.DBSystemNameMySQL))
+	defer span.End()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		fail(span, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+func fail(span trace.Span, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
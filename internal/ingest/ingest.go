@@ -0,0 +1,47 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"go-axfr-backend/internal/config"
+	"go-axfr-backend/internal/database"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Run transfers the zone configured for tld and applies it to the TLD's dump and diff databases
+// as the snapshot for date.
+func Run(ctx context.Context, pools *database.Pools, cfg *config.Config, tld string, date time.Time) (Result, error) {
+	entry, ok := cfg.TLDs[tld]
+	if !ok {
+		return Result{}, fmt.Errorf("unsupported TLD: %s", tld)
+	}
+	if entry.AXFR == nil {
+		return Result{}, fmt.Errorf("no axfr source configured for TLD: %s", tld)
+	}
+
+	day, err := strconv.Atoi(date.Format("20060102"))
+	if err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	domains, err := Transfer(ctx, entry.AXFR.Server, entry.AXFR.Zone, entry.AXFR.Timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	slog.InfoContext(ctx, "transferred zone", slog.String("zone", entry.AXFR.Zone), slog.String("server", entry.AXFR.Server),
+		slog.Int("domains", len(domains)), slog.Duration("took", time.Since(start)))
+
+	db, err := pools.Get(ctx, *entry.Dump, cfg.Pool)
+	if err != nil {
+		return Result{}, fmt.Errorf("connecting to %s: %w", entry.Dump.ID, err)
+	}
+
+	result, err := Apply(ctx, db, entry.Dump.Name, entry.Diff.Name, day, domains)
+	if err != nil {
+		return result, fmt.Errorf("applying %s snapshot for %d: %w", tld, day, err)
+	}
+	return result, nil
+}
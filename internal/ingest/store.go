@@ -0,0 +1,163 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// insertBatchSize bounds the number of rows per multi-row INSERT.
+const insertBatchSize = 1000
+
+var ErrAlreadyIngested = errors.New("zone already ingested for this date")
+
+// Result summarizes one ingestion run.
+type Result struct {
+	Date    int `json:"date"`
+	Total   int `json:"total"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	// Bootstrap is set when the dump was empty, in which case the day is recorded without diff rows.
+	Bootstrap bool `json:"bootstrap"`
+}
+
+// Diff returns the domains only in current (added) and only in previous (removed).
+// Both inputs must be sorted.
+func Diff(previous []string, current []string) (added []string, removed []string) {
+	i, j := 0, 0
+	for i < len(previous) && j < len(current) {
+		switch {
+		case previous[i] == current[j]:
+			i++
+			j++
+		case previous[i] < current[j]:
+			removed = append(removed, previous[i])
+			i++
+		default:
+			added = append(added, current[j])
+			j++
+		}
+	}
+	removed = append(removed, previous[i:]...)
+	added = append(added, current[j:]...)
+	return added, removed
+}
+
+// Apply replaces the dump database's domains with the sorted current set and records the day's
+// additions and removals in the diff database, all in one transaction on db. dumpName and diffName
+// qualify the tables, so both databases must be reachable through db.
+func Apply(ctx context.Context, db *sql.DB, dumpName string, diffName string, date int, current []string) (Result, error) {
+	result := Result{Date: date, Total: len(current)}
+
+	dumpDomains := "`" + dumpName + "`.`domains`"
+	dumpDates := "`" + dumpName + "`.`dates`"
+	diffDates := "`" + diffName + "`.`dates`"
+	diffDomains := "`" + diffName + "`.`domains`"
+	diffRemoved := "`" + diffName + "`.`removed`"
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+diffDates+" WHERE date = ?", date).Scan(&existing)
+	if err != nil {
+		return result, fmt.Errorf("checking diff dates: %w", err)
+	}
+	if existing > 0 {
+		return result, ErrAlreadyIngested
+	}
+
+	previous, err := queryDomains(ctx, tx, "SELECT domain FROM "+dumpDomains+" FOR UPDATE")
+	if err != nil {
+		return result, fmt.Errorf("reading dump domains: %w", err)
+	}
+	// Sort in Go, MySQL collation order need not match byte order.
+	sort.Strings(previous)
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+dumpDomains); err != nil {
+		return result, fmt.Errorf("clearing dump domains: %w", err)
+	}
+	if err := insertDomains(ctx, tx, "INSERT INTO "+dumpDomains+" (domain) VALUES ", "(?)", nil, current); err != nil {
+		return result, fmt.Errorf("writing dump domains: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO "+dumpDates+" (date, amount) VALUES (?, ?)", date, len(current)); err != nil {
+		return result, fmt.Errorf("writing dump dates: %w", err)
+	}
+
+	var added, removed []string
+	if len(previous) == 0 {
+		// Everything would count as added; record the day so reruns are still rejected.
+		result.Bootstrap = true
+	} else {
+		added, removed = Diff(previous, current)
+		result.Added, result.Removed = len(added), len(removed)
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO "+diffDates+" (date, amount, removed) VALUES (?, ?, ?)", date, len(added), len(removed))
+	if err != nil {
+		return result, fmt.Errorf("writing diff dates: %w", err)
+	}
+	dategrp, err := res.LastInsertId()
+	if err != nil {
+		return result, fmt.Errorf("reading diff date id: %w", err)
+	}
+
+	if err := insertDomains(ctx, tx, "INSERT INTO "+diffDomains+" (dategrp, domain) VALUES ", "(?, ?)", dategrp, added); err != nil {
+		return result, fmt.Errorf("writing added domains: %w", err)
+	}
+	if err := insertDomains(ctx, tx, "INSERT INTO "+diffRemoved+" (dategrp, domain) VALUES ", "(?, ?)", dategrp, removed); err != nil {
+		return result, fmt.Errorf("writing removed domains: %w", err)
+	}
+
+	return result, tx.Commit()
+}
+
+func queryDomains(ctx context.Context, tx *sql.Tx, query string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// insertDomains writes domains in batches. When dategrp is non-nil it is bound before every domain.
+func insertDomains(ctx context.Context, tx *sql.Tx, prefix string, placeholder string, dategrp any, domains []string) error {
+	for start := 0; start < len(domains); start += insertBatchSize {
+		batch := domains[start:min(start+insertBatchSize, len(domains))]
+
+		var query strings.Builder
+		query.WriteString(prefix)
+		args := make([]any, 0, 2*len(batch))
+		for i, domain := range batch {
+			if i > 0 {
+				query.WriteByte(',')
+			}
+			query.WriteString(placeholder)
+			if dategrp != nil {
+				args = append(args, dategrp)
+			}
+			args = append(args, domain)
+		}
+
+		if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
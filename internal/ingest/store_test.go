@@ -0,0 +1,274 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		previous    []string
+		current     []string
+		wantAdded   string
+		wantRemoved string
+	}{
+		{
+			name:     "unchanged",
+			previous: []string{"a.se", "b.se"},
+			current:  []string{"a.se", "b.se"},
+		},
+		{
+			name:        "additions and removals",
+			previous:    []string{"a.se", "c.se", "e.se"},
+			current:     []string{"b.se", "c.se", "d.se", "f.se"},
+			wantAdded:   "b.se,d.se,f.se",
+			wantRemoved: "a.se,e.se",
+		},
+		{
+			name:      "empty previous",
+			current:   []string{"a.se"},
+			wantAdded: "a.se",
+		},
+		{
+			name:        "empty current",
+			previous:    []string{"a.se", "b.se"},
+			wantRemoved: "a.se,b.se",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := Diff(tt.previous, tt.current)
+			if got := strings.Join(added, ","); got != tt.wantAdded {
+				t.Errorf("Diff() added = %v, want %v", got, tt.wantAdded)
+			}
+			if got := strings.Join(removed, ","); got != tt.wantRemoved {
+				t.Errorf("Diff() removed = %v, want %v", got, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+// fakeTables is the content of the sedump and sediff tables Apply writes. Diff rows are
+// "<dategrp>:<domain>", a diff date's id is its index plus one.
+type fakeTables struct {
+	dumpDomains []string
+	dumpDates   []int64
+	diffDates   []int64
+	added       []string
+	removed     []string
+}
+
+func (t fakeTables) clone() fakeTables {
+	return fakeTables{
+		dumpDomains: slices.Clone(t.dumpDomains),
+		dumpDates:   slices.Clone(t.dumpDates),
+		diffDates:   slices.Clone(t.diffDates),
+		added:       slices.Clone(t.added),
+		removed:     slices.Clone(t.removed),
+	}
+}
+
+// fakeStore is a database/sql driver serving the statements of Apply from fakeTables, so Apply can be
+// tested without MySQL. It logs every statement up to its VALUES and fails the first one containing
+// failOn.
+type fakeStore struct {
+	mu     sync.Mutex
+	tables fakeTables
+	begun  fakeTables
+	log    []string
+	failOn string
+}
+
+func (s *fakeStore) Connect(context.Context) (driver.Conn, error) { return fakeConn{s}, nil }
+func (s *fakeStore) Driver() driver.Driver                        { return nil }
+
+func (s *fakeStore) record(query string) {
+	query, _, _ = strings.Cut(query, " VALUES")
+	s.log = append(s.log, query)
+}
+
+type fakeConn struct{ s *fakeStore }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.record("BEGIN")
+	c.s.begun = c.s.tables.clone()
+	return c, nil
+}
+
+func (c fakeConn) Commit() error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.record("COMMIT")
+	return nil
+}
+
+func (c fakeConn) Rollback() error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.record("ROLLBACK")
+	c.s.tables = c.s.begun
+	return nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.record(query)
+	t := &c.s.tables
+	switch {
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM `sediff`.`dates`"):
+		n := 0
+		for _, date := range t.diffDates {
+			if date == args[0].Value {
+				n++
+			}
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(n)}}}, nil
+	case strings.HasPrefix(query, "SELECT domain FROM `sedump`.`domains`"):
+		rows := &fakeRows{}
+		for _, domain := range t.dumpDomains {
+			rows.values = append(rows.values, []driver.Value{domain})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.record(query)
+	if c.s.failOn != "" && strings.Contains(query, c.s.failOn) {
+		return nil, errors.New("injected failure")
+	}
+	t := &c.s.tables
+	pairs := func() (rows []string) {
+		for i := 0; i+1 < len(args); i += 2 {
+			rows = append(rows, fmt.Sprintf("%v:%v", args[i].Value, args[i+1].Value))
+		}
+		return rows
+	}
+	switch {
+	case query == "DELETE FROM `sedump`.`domains`":
+		t.dumpDomains = nil
+	case strings.HasPrefix(query, "INSERT INTO `sedump`.`domains`"):
+		for _, arg := range args {
+			t.dumpDomains = append(t.dumpDomains, arg.Value.(string))
+		}
+	case strings.HasPrefix(query, "INSERT INTO `sedump`.`dates`"):
+		t.dumpDates = append(t.dumpDates, args[0].Value.(int64))
+	case strings.HasPrefix(query, "INSERT INTO `sediff`.`dates`"):
+		t.diffDates = append(t.diffDates, args[0].Value.(int64))
+	case strings.HasPrefix(query, "INSERT INTO `sediff`.`domains`"):
+		t.added = append(t.added, pairs()...)
+	case strings.HasPrefix(query, "INSERT INTO `sediff`.`removed`"):
+		t.removed = append(t.removed, pairs()...)
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	return fakeResult{int64(len(t.diffDates))}, nil
+}
+
+// fakeResult reports the id of the last diff date, which is all Apply reads.
+type fakeResult struct{ lastID int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (fakeResult) RowsAffected() (int64, error)   { return 1, nil }
+
+type fakeRows struct{ values [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return make([]string, len(r.values[0])) }
+func (*fakeRows) Close() error        { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	store := &fakeStore{tables: fakeTables{dumpDomains: []string{"b.se", "a.se"}, dumpDates: []int64{20250101}}}
+	db := sql.OpenDB(store)
+	defer db.Close()
+	ctx := context.Background()
+
+	result, err := Apply(ctx, db, "sedump", "sediff", 20250102, []string{"b.se", "c.se"})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := (Result{Date: 20250102, Total: 2, Added: 1, Removed: 1}); result != want {
+		t.Errorf("Apply() = %+v, want %+v", result, want)
+	}
+	wantLog := []string{
+		"BEGIN",
+		"SELECT COUNT(*) FROM `sediff`.`dates` WHERE date = ?",
+		"SELECT domain FROM `sedump`.`domains` FOR UPDATE",
+		"DELETE FROM `sedump`.`domains`",
+		"INSERT INTO `sedump`.`domains` (domain)",
+		"INSERT INTO `sedump`.`dates` (date, amount)",
+		"INSERT INTO `sediff`.`dates` (date, amount, removed)",
+		"INSERT INTO `sediff`.`domains` (dategrp, domain)",
+		"INSERT INTO `sediff`.`removed` (dategrp, domain)",
+		"COMMIT",
+	}
+	if !slices.Equal(store.log, wantLog) {
+		t.Errorf("Apply() statements =\n%s\nwant\n%s", strings.Join(store.log, "\n"), strings.Join(wantLog, "\n"))
+	}
+	want := fakeTables{
+		dumpDomains: []string{"b.se", "c.se"},
+		dumpDates:   []int64{20250101, 20250102},
+		diffDates:   []int64{20250102},
+		added:       []string{"1:c.se"},
+		removed:     []string{"1:a.se"},
+	}
+	if fmt.Sprint(store.tables) != fmt.Sprint(want) {
+		t.Errorf("tables after Apply() = %+v, want %+v", store.tables, want)
+	}
+
+	// Running the same day again must not write a second set of diff rows.
+	store.log = nil
+	if _, err := Apply(ctx, db, "sedump", "sediff", 20250102, []string{"c.se", "d.se"}); !errors.Is(err, ErrAlreadyIngested) {
+		t.Errorf("Apply() of an ingested date error = %v, want ErrAlreadyIngested", err)
+	}
+	if got := store.log[len(store.log)-1]; got != "ROLLBACK" {
+		t.Errorf("Apply() of an ingested date ended with %q, want ROLLBACK", got)
+	}
+	if fmt.Sprint(store.tables) != fmt.Sprint(want) {
+		t.Errorf("tables after rerun = %+v, want %+v", store.tables, want)
+	}
+}
+
+func TestApplyRollsBackOnFailure(t *testing.T) {
+	seed := fakeTables{dumpDomains: []string{"a.se", "b.se"}, dumpDates: []int64{20250101}}
+	// The last write of the transaction fails, after the dump was already replaced.
+	store := &fakeStore{tables: seed.clone(), failOn: "`sediff`.`removed`"}
+	db := sql.OpenDB(store)
+	defer db.Close()
+
+	if _, err := Apply(context.Background(), db, "sedump", "sediff", 20250102, []string{"b.se", "c.se"}); err == nil {
+		t.Fatal("Apply() with a failing statement succeeded")
+	}
+	if got := store.log[len(store.log)-1]; got != "ROLLBACK" {
+		t.Errorf("Apply() with a failing statement ended with %q, want ROLLBACK", got)
+	}
+	if fmt.Sprint(store.tables) != fmt.Sprint(seed) {
+		t.Errorf("tables after failed Apply() = %+v, want %+v", store.tables, seed)
+	}
+}
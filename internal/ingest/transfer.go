@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// NormalizeOwner maps a record owner name to the registered domain it delegates, e.g. "Example.SE."
+// in zone "se." becomes "example.se". Only direct children of the zone are domains; the apex, glue
+// and names that need escaping are rejected.
+func NormalizeOwner(owner string, zone string) (string, bool) {
+	name := dns.CanonicalName(owner)
+	zone = dns.CanonicalName(zone)
+
+	if strings.ContainsRune(name, '\\') {
+		return "", false
+	}
+	if !dns.IsSubDomain(zone, name) || dns.CountLabel(name) != dns.CountLabel(zone)+1 {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."), true
+}
+
+// Transfer performs an AXFR of zone from server and returns the sorted, de-duplicated set of
+// delegated domains, i.e. the normalized owners of NS records below the apex.
+func Transfer(ctx context.Context, server string, zone string, timeout time.Duration) ([]string, error) {
+	zone = dns.Fqdn(zone)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	msg := new(dns.Msg)
+	msg.SetAxfr(zone)
+
+	tr := &dns.Transfer{
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+	envelopes, err := tr.In(msg, server)
+	if err != nil {
+		return nil, fmt.Errorf("axfr %s from %s: %w", zone, server, err)
+	}
+
+	seen := make(map[string]struct{})
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, fmt.Errorf("axfr %s from %s: %w", zone, server, env.Error)
+		}
+		if err := ctx.Err(); err != nil {
+			// Drain so the transfer goroutine can exit.
+			go func() {
+				for range envelopes {
+				}
+			}()
+			return nil, err
+		}
+		for _, rr := range env.RR {
+			if rr.Header().Rrtype != dns.TypeNS {
+				continue
+			}
+			if domain, ok := NormalizeOwner(rr.Header().Name, zone); ok {
+				seen[domain] = struct{}{}
+			}
+		}
+	}
+
+	domains := make([]string, 0, len(seen))
+	for domain := range seen {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
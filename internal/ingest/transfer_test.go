@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// serveZone starts a local authoritative stand-in that answers AXFR for the fixture zone file.
+func serveZone(t *testing.T, origin string, path string) string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening zone fixture: %v", err)
+	}
+	defer f.Close()
+
+	var records []dns.RR
+	zp := dns.NewZoneParser(f, origin, path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("parsing zone fixture: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(origin, func(w dns.ResponseWriter, req *dns.Msg) {
+		if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeAXFR {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+
+		// AXFR starts and ends with the SOA, and is split over several envelopes.
+		ch := make(chan *dns.Envelope)
+		go func() {
+			ch <- &dns.Envelope{RR: records[:len(records)/2]}
+			ch <- &dns.Envelope{RR: append(records[len(records)/2:], records[0])}
+			close(ch)
+		}()
+		tr := new(dns.Transfer)
+		tr.Out(w, req, ch)
+		w.Hijack()
+	})
+
+	server := &dns.Server{Listener: listener, Handler: mux}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return listener.Addr().String()
+}
+
+func TestTransfer(t *testing.T) {
+	addr := serveZone(t, "se.", "testdata/se.zone")
+
+	domains, err := Transfer(context.Background(), addr, "se", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+
+	want := "example.se,gammal.se,xn--rksmrgs-5wao1o.se"
+	if got := strings.Join(domains, ","); got != want {
+		t.Errorf("Transfer() = %v, want %v", got, want)
+	}
+}
+
+func TestTransferRefused(t *testing.T) {
+	addr := serveZone(t, "se.", "testdata/se.zone")
+
+	if _, err := Transfer(context.Background(), addr, "nu.", 5*time.Second); err == nil {
+		t.Error("Transfer() of unserved zone succeeded")
+	}
+}
+
+func TestNormalizeOwner(t *testing.T) {
+	tests := []struct {
+		owner  string
+		zone   string
+		want   string
+		wantOK bool
+	}{
+		{owner: "Example.SE.", zone: "se.", want: "example.se", wantOK: true},
+		{owner: "example.se", zone: "se", want: "example.se", wantOK: true},
+		{owner: "se.", zone: "se.", wantOK: false},
+		{owner: "ns1.example.se.", zone: "se.", wantOK: false},
+		{owner: "example.nu.", zone: "se.", wantOK: false},
+		{owner: `exa\032mple.se.`, zone: "se.", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			got, ok := NormalizeOwner(tt.owner, tt.zone)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("NormalizeOwner(%q, %q) = %q, %v, want %q, %v", tt.owner, tt.zone, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"go-axfr-backend/internal/database"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolCollector(t *testing.T) {
+	RegisterPools(func() map[string]database.Stats {
+		return map[string]database.Stats{
+			"se/dump": {MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2},
+			"auth":    {MaxOpenConnections: 10, OpenConnections: 1, InUse: 0, Idle: 1},
+		}
+	})
+
+	want := `
+# HELP axfr_db_pool_in_use_connections Connections currently in use.
+# TYPE axfr_db_pool_in_use_connections gauge
+axfr_db_pool_in_use_connections{database="auth",tld=""} 0
+axfr_db_pool_in_use_connections{database="dump",tld="se"} 1
+# HELP axfr_db_pool_open_connections Established connections, in use and idle.
+# TYPE axfr_db_pool_open_connections gauge
+axfr_db_pool_open_connections{database="auth",tld=""} 1
+axfr_db_pool_open_connections{database="dump",tld="se"} 3
+`
+	err := testutil.GatherAndCompare(Registry, strings.NewReader(want),
+		"axfr_db_pool_in_use_connections", "axfr_db_pool_open_connections")
+	if err != nil {
+		t.Error(err)
+	}
+}
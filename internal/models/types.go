@@ -15,6 +15,7 @@ type DateAmount struct {
 }
 
 type DbConfig struct {
+	Host     string
 	Database string
 	Username string
 	Password string
@@ -0,0 +1,177 @@
+package ngram
+
+import (
+	"slices"
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// Index is an immutable in-memory trigram index over a sorted set of domains. Domain IDs are
+// positions in the sorted slice, so posting lists in ID order are also in domain order.
+type Index struct {
+	domains  []string
+	postings map[uint32][]uint32
+
+	// Version identifies the data the index was built from, e.g. the dump's latest dates.id.
+	Version int64
+	BuiltAt time.Time
+}
+
+// Query selects domains from an index. Every domain that matches must contain all Literals; the
+// literals only narrow the candidates, Match decides. A nil Match accepts every candidate.
+type Query struct {
+	Literals []string
+	Match    func(domain string) bool
+}
+
+func trigram(s string, i int) uint32 {
+	return uint32(s[i])<<16 | uint32(s[i+1])<<8 | uint32(s[i+2])
+}
+
+// Build indexes domains, which need not be sorted or unique.
+func Build(domains []string, version int64) *Index {
+	sorted := slices.Clone(domains)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	ix := &Index{
+		domains:  sorted,
+		postings: make(map[uint32][]uint32),
+		Version:  version,
+		BuiltAt:  time.Now(),
+	}
+	for id, domain := range sorted {
+		for i := 0; i+3 <= len(domain); i++ {
+			t := trigram(domain, i)
+			list := ix.postings[t]
+			// The same trigram can occur twice in one domain; IDs are appended in order.
+			if n := len(list); n == 0 || list[n-1] != uint32(id) {
+				ix.postings[t] = append(list, uint32(id))
+			}
+		}
+	}
+	return ix
+}
+
+// Len returns the number of indexed domains.
+func (ix *Index) Len() int {
+	return len(ix.domains)
+}
+
+// Trigrams returns the number of distinct trigrams.
+func (ix *Index) Trigrams() int {
+	return len(ix.postings)
+}
+
+// MemoryBytes estimates the heap used by the index: domain strings and headers, posting lists and
+// a per-entry allowance for the map buckets.
+func (ix *Index) MemoryBytes() int64 {
+	const mapEntryOverhead = 16
+	var n int64
+	n += int64(len(ix.domains)) * int64(unsafe.Sizeof(""))
+	for _, d := range ix.domains {
+		n += int64(len(d))
+	}
+	for _, list := range ix.postings {
+		n += int64(unsafe.Sizeof(list)) + int64(cap(list))*4 + 4 + mapEntryOverhead
+	}
+	return n
+}
+
+// candidates returns the posting list intersection for all trigrams of the literals, or nil with
+// ok=false when no literal is long enough to narrow the search.
+func (ix *Index) candidates(literals []string) (ids []uint32, ok bool) {
+	var lists [][]uint32
+	for _, lit := range literals {
+		for i := 0; i+3 <= len(lit); i++ {
+			list, found := ix.postings[trigram(lit, i)]
+			if !found {
+				return nil, true
+			}
+			lists = append(lists, list)
+		}
+	}
+	if len(lists) == 0 {
+		return nil, false
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	ids = slices.Clone(lists[0])
+	for _, list := range lists[1:] {
+		ids = intersect(ids, list)
+		if len(ids) == 0 {
+			break
+		}
+	}
+	return ids, true
+}
+
+// intersect keeps the IDs of a that are also in b, reusing a's storage.
+func intersect(a []uint32, b []uint32) []uint32 {
+	out := a[:0]
+	j := 0
+	for _, id := range a {
+		for j < len(b) && b[j] < id {
+			j++
+		}
+		if j == len(b) {
+			break
+		}
+		if b[j] == id {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Find returns up to limit matching domains strictly after the domain after (before it when reverse
+// is set), in domain order or reverse domain order respectively. An empty after starts from the
+// beginning (or end) and a negative limit returns every match.
+func (ix *Index) Find(q Query, after string, reverse bool, limit int) []string {
+	if limit == 0 {
+		return nil
+	}
+
+	// IDs strictly after `after` start at lo, IDs strictly before it end before hi.
+	lo, hi := 0, len(ix.domains)
+	if after != "" {
+		if reverse {
+			hi = sort.SearchStrings(ix.domains, after)
+		} else {
+			lo = sort.Search(len(ix.domains), func(i int) bool { return ix.domains[i] > after })
+		}
+	}
+
+	var out []string
+	accept := func(id int) bool {
+		domain := ix.domains[id]
+		if q.Match == nil || q.Match(domain) {
+			out = append(out, domain)
+		}
+		return limit < 0 || len(out) < limit
+	}
+
+	ids, narrowed := ix.candidates(q.Literals)
+	if !narrowed {
+		if reverse {
+			for id := hi - 1; id >= lo && accept(id); id-- {
+			}
+		} else {
+			for id := lo; id < hi && accept(id); id++ {
+			}
+		}
+		return out
+	}
+
+	start := sort.Search(len(ids), func(i int) bool { return int(ids[i]) >= lo })
+	end := sort.Search(len(ids), func(i int) bool { return int(ids[i]) >= hi })
+	if reverse {
+		for i := end - 1; i >= start && accept(int(ids[i])); i-- {
+		}
+	} else {
+		for i := start; i < end && accept(int(ids[i])); i++ {
+		}
+	}
+	return out
+}
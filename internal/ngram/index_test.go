@@ -0,0 +1,107 @@
+package ngram
+
+import (
+	"strings"
+	"testing"
+)
+
+var fixture = []string{
+	"010.nu", "010acupunctuur.nu", "010housing.nu", "010jongeren.nu", "010jongerenwerk.nu",
+	"0110.nu", "011.nu", "badrumonline.nu", "badrumsdeal.nu", "badrumsproffs.nu",
+	"digitalisering.nu", "jonah.nu", "xn--hemstd-fua.nu", "badrumsdeal.nu",
+}
+
+func contains(term string) Query {
+	return Query{
+		Literals: []string{term},
+		Match:    func(d string) bool { return strings.Contains(d, term) },
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ix := Build(fixture, 42)
+
+	if ix.Len() != len(fixture)-1 {
+		t.Errorf("Len() = %d, want %d (duplicates removed)", ix.Len(), len(fixture)-1)
+	}
+	if ix.Version != 42 {
+		t.Errorf("Version = %d, want 42", ix.Version)
+	}
+	if ix.Trigrams() == 0 || ix.MemoryBytes() <= 0 {
+		t.Errorf("Trigrams() = %d, MemoryBytes() = %d, want positive", ix.Trigrams(), ix.MemoryBytes())
+	}
+}
+
+func TestFind(t *testing.T) {
+	ix := Build(fixture, 1)
+
+	tests := []struct {
+		name    string
+		query   Query
+		after   string
+		reverse bool
+		limit   int
+		want    string
+	}{
+		{
+			name:  "substring",
+			query: contains("010"),
+			limit: -1,
+			want:  "010.nu,010acupunctuur.nu,010housing.nu,010jongeren.nu,010jongerenwerk.nu",
+		},
+		{
+			name:  "substring verified after trigram match",
+			query: contains("jongerenw"),
+			limit: -1,
+			want:  "010jongerenwerk.nu",
+		},
+		{
+			name:  "unknown trigram",
+			query: contains("zzz"),
+			limit: -1,
+			want:  "",
+		},
+		{
+			name:  "short term scans everything",
+			query: contains("a"),
+			limit: 3,
+			want:  "010acupunctuur.nu,badrumonline.nu,badrumsdeal.nu",
+		},
+		{
+			name:  "after cursor",
+			query: contains("010"),
+			after: "010housing.nu",
+			limit: 2,
+			want:  "010jongeren.nu,010jongerenwerk.nu",
+		},
+		{
+			name:    "reverse before cursor",
+			query:   contains("010"),
+			after:   "010housing.nu",
+			reverse: true,
+			limit:   -1,
+			want:    "010acupunctuur.nu,010.nu",
+		},
+		{
+			name:  "nil match accepts candidates",
+			query: Query{Literals: []string{"badrum"}},
+			limit: -1,
+			want:  "badrumonline.nu,badrumsdeal.nu,badrumsproffs.nu",
+		},
+		{
+			name:  "zero limit",
+			query: contains("010"),
+			limit: 0,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(ix.Find(tt.query, tt.after, tt.reverse, tt.limit), ",")
+			if got != tt.want {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes parses trusted proxy CIDRs; a bare address stands for itself.
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func trustedAddr(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address r came from. X-Forwarded-For is only honored on connections from a
+// trusted proxy, and read from the right so clients cannot spoof the hops proxies appended; the
+// first untrusted hop is the client. Peers on the unix socket are local proxies and always
+// trusted; without a forwarded address their requests get the zero Addr.
+func ClientIP(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	var addr netip.Addr
+	if peer, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		addr = peer.Addr().Unmap()
+		if !trustedAddr(addr, trusted) {
+			return addr
+		}
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !trustedAddr(addr, trusted) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// Subject returns the bucket name part for a client address. IPv6 clients are grouped by /64, the
+// smallest block usually assigned to one site; unknown addresses share one bucket.
+func Subject(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return "unknown"
+	}
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
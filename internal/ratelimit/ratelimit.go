@@ -0,0 +1,96 @@
+// Package ratelimit limits request rates with token buckets, kept in Redis so every node draws from
+// the same bucket or in process memory, and resolves the client address buckets are keyed by.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst requests, refilled at Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit restricts anything; the zero Limit does not.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Policy formats the limit for the RateLimit-Policy header: the burst and the seconds it takes to refill.
+func (l Limit) Policy() string {
+	window := int(math.Ceil(float64(l.Burst) / l.Rate))
+	return strconv.Itoa(l.Burst) + ";w=" + strconv.Itoa(window)
+}
+
+// Result is the state of a bucket after a request was charged against it.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Time
+	// RetryAt is when the next request is allowed, set when the request was not.
+	RetryAt time.Time
+}
+
+// Limiter charges requests against buckets.
+type Limiter interface {
+	// Allow takes a token from the bucket named key at now, creating it full.
+	Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	Close() error
+}
+
+// refill returns the tokens of a bucket that held tokens elapsed ago.
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// result describes a bucket left with tokens at now.
+func result(limit Limit, tokens float64, allowed bool, now time.Time) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     now.Add(time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second))),
+	}
+	if !allowed {
+		res.RetryAt = now.Add(time.Duration((1 - tokens) / limit.Rate * float64(time.Second)))
+	}
+	return res
+}
+
+// Fallback limits with Primary and switches to Secondary while Primary fails, so an unreachable
+// Redis degrades to per-node limits instead of failing every request.
+type Fallback struct {
+	Primary   Limiter
+	Secondary Limiter
+	failing   atomic.Bool
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	res, err := f.Primary.Allow(ctx, key, limit, now)
+	if err == nil {
+		if f.failing.CompareAndSwap(true, false) {
+			slog.InfoContext(ctx, "rate limiter recovered")
+		}
+		return res, nil
+	}
+	if f.failing.CompareAndSwap(false, true) {
+		slog.WarnContext(ctx, "rate limiter failed, limiting per node", slog.Any("error", err))
+	}
+	return f.Secondary.Allow(ctx, key, limit, now)
+}
+
+func (f *Fallback) Close() error {
+	f.Secondary.Close()
+	return f.Primary.Close()
+}
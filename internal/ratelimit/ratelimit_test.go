@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Rate: 2, Burst: 3}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 2; i >= 0; i-- {
+		res, _ := m.Allow(context.Background(), "a", limit, now)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", 3-i, res, i)
+		}
+	}
+	res, _ := m.Allow(context.Background(), "a", limit, now)
+	if res.Allowed || !res.RetryAt.Equal(now.Add(500*time.Millisecond)) || !res.Reset.Equal(now.Add(1500*time.Millisecond)) {
+		t.Errorf("empty bucket = %+v, want denied, retry in 500ms and full in 1.5s", res)
+	}
+	if res, _ := m.Allow(context.Background(), "b", limit, now); !res.Allowed {
+		t.Errorf("bucket b = %+v, want its own full bucket", res)
+	}
+
+	res, _ = m.Allow(context.Background(), "a", limit, now.Add(500*time.Millisecond))
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 500ms = %+v, want one refilled token taken", res)
+	}
+
+	// Buckets that refilled are dropped by the next sweep.
+	m.Allow(context.Background(), "c", limit, now.Add(time.Hour))
+	if m.Len() != 1 {
+		t.Errorf("buckets after sweep = %d, want 1", m.Len())
+	}
+}
+
+type failingLimiter struct{ err error }
+
+func (f failingLimiter) Allow(context.Context, string, Limit, time.Time) (Result, error) {
+	return Result{}, f.err
+}
+
+func (f failingLimiter) Close() error { return nil }
+
+func TestFallback(t *testing.T) {
+	primary := &failingLimiter{err: errors.New("connection refused")}
+	f := &Fallback{Primary: primary, Secondary: NewMemory()}
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+
+	if res, err := f.Allow(context.Background(), "a", limit, now); err != nil || !res.Allowed {
+		t.Fatalf("Allow() = %+v, %v, want the memory bucket", res, err)
+	}
+	if res, _ := f.Allow(context.Background(), "a", limit, now); res.Allowed {
+		t.Errorf("second Allow() = %+v, want the memory bucket emptied", res)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "198.51.100.7:4000", "", "198.51.100.7"},
+		{"untrusted peer ignores header", "198.51.100.7:4000", "203.0.113.9", "198.51.100.7"},
+		{"trusted proxy", "10.1.2.3:4000", "203.0.113.9", "203.0.113.9"},
+		{"spoofed left hop", "10.1.2.3:4000", "1.2.3.4, 203.0.113.9, 192.0.2.1", "203.0.113.9"},
+		{"only proxies", "10.1.2.3:4000", "10.9.9.9", "10.9.9.9"},
+		{"garbage hop", "10.1.2.3:4000", "203.0.113.9, nonsense", "10.1.2.3"},
+		{"unix socket", "@", "203.0.113.9", "203.0.113.9"},
+		{"ipv6 grouped", "[2001:db8:1:2:3::4]:4000", "", "2001:db8:1:2::/64"},
+		{"unknown", "@", "", "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := Subject(ClientIP(r, trusted)); got != tt.want {
+				t.Errorf("client = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParsePrefixes() accepted an invalid CIDR")
+	}
+}
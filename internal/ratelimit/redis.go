@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket hash KEYS[1] atomically, timed by the Redis clock so
+// nodes with skewed clocks agree. ARGV is the rate per second and the burst; it returns whether the
+// request is allowed and the tokens left, as a string since Lua numbers are truncated on return.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Redis keeps buckets in Redis, shared by every node. Buckets expire once they have refilled.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis keeps buckets on the Redis server at addr.
+func NewRedis(addr string) *Redis {
+	return &Redis{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (l *Redis) Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	reply, err := takeScript.Run(ctx, l.client, []string{key}, limit.Rate, limit.Burst).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := reply[0].(int64)
+	left, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(limit, tokens, allowed == 1, now), nil
+}
+
+func (l *Redis) Close() error {
+	return l.client.Close()
+}
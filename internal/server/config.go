@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the listener settings of the API and admin servers. It is read from the environment
+// at startup; TLD registry reloads do not touch it.
+type Config struct {
+	// Addr is the TCP address of the API, ignored when Socket is set.
+	Addr string
+	// Socket is the path of a unix socket to serve the API on instead of Addr.
+	Socket string
+	// AdminAddr is the TCP address of the admin listener serving /metrics.
+	AdminAddr string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TLSCert and TLSKey enable HTTPS on the API when both are set. The pair is re-read on SIGHUP.
+	TLSCert string
+	TLSKey  string
+
+	// DrainDelay is how long /ready reports failure before the listeners close, giving load
+	// balancers time to stop routing new requests to this instance.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to finish after draining.
+	ShutdownTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	Addr:              ":8080",
+	AdminAddr:         ":9090",
+	ReadTimeout:       15 * time.Second,
+	ReadHeaderTimeout: 5 * time.Second,
+	WriteTimeout:      60 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	DrainDelay:        5 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+// FromEnv reads the server settings, falling back to DefaultConfig for unset variables.
+func FromEnv() (Config, error) {
+	cfg := DefaultConfig
+	cfg.Addr = envString("HTTP_ADDR", cfg.Addr)
+	cfg.Socket = os.Getenv("HTTP_SOCKET")
+	cfg.AdminAddr = envString("ADMIN_ADDR", cfg.AdminAddr)
+	cfg.TLSCert = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKey = os.Getenv("TLS_KEY_FILE")
+
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"SHUTDOWN_DRAIN_DELAY", &cfg.DrainDelay},
+		{"SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		if parsed < 0 {
+			return Config{}, fmt.Errorf("invalid %s: must not be negative", d.name)
+		}
+		*d.dst = parsed
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return Config{}, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	return cfg, nil
+}
+
+// TLS reports whether the API is served over HTTPS.
+func (c Config) TLS() bool {
+	return c.TLSCert != ""
+}
+
+func envString(name string, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
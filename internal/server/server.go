@@ -0,0 +1,124 @@
+// Package server runs the API and admin HTTP servers with timeouts, optional TLS and unix socket
+// listeners, and a graceful drain on shutdown.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Server is the API server and its admin listener.
+type Server struct {
+	cfg   Config
+	api   *http.Server
+	admin *http.Server
+	certs *CertReloader
+}
+
+// New builds the servers for cfg. The certificate is loaded here so a bad key pair fails startup.
+func New(cfg Config, api http.Handler, admin http.Handler) (*Server, error) {
+	s := &Server{cfg: cfg, api: newHTTPServer(cfg, api), admin: newHTTPServer(cfg, admin)}
+	if cfg.TLS() {
+		certs, err := NewCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.api.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	}
+	return s, nil
+}
+
+func newHTTPServer(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// Run serves until ctx is done or a listener fails. Once ctx is done it calls drain, which should
+// make the readiness probe fail, waits DrainDelay for load balancers to notice, then closes the
+// listeners and waits up to ShutdownTimeout for in-flight requests to finish.
+func (s *Server) Run(ctx context.Context, drain func()) error {
+	apiListener, err := s.listenAPI()
+	if err != nil {
+		return err
+	}
+	adminListener, err := net.Listen("tcp", s.cfg.AdminAddr)
+	if err != nil {
+		apiListener.Close()
+		return fmt.Errorf("listening on admin address %s: %w", s.cfg.AdminAddr, err)
+	}
+
+	if s.certs != nil {
+		stop := s.certs.ReloadOnSignal(syscall.SIGHUP)
+		defer stop()
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		slog.Info("serving API", slog.String("addr", apiListener.Addr().String()), slog.Bool("tls", s.certs != nil))
+		if s.certs != nil {
+			errc <- s.api.ServeTLS(apiListener, "", "")
+		} else {
+			errc <- s.api.Serve(apiListener)
+		}
+	}()
+	go func() {
+		slog.Info("serving metrics", slog.String("addr", adminListener.Addr().String()))
+		errc <- s.admin.Serve(adminListener)
+	}()
+
+	select {
+	case err := <-errc:
+		s.api.Close()
+		s.admin.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("draining", slog.Duration("delay", s.cfg.DrainDelay))
+	drain()
+	time.Sleep(s.cfg.DrainDelay)
+
+	slog.Info("shutting down", slog.Duration("timeout", s.cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	return errors.Join(s.api.Shutdown(shutdownCtx), s.admin.Shutdown(shutdownCtx))
+}
+
+// listenAPI listens on the unix socket when one is configured, replacing a stale socket file left
+// by a previous run, and on the TCP address otherwise.
+func (s *Server) listenAPI() (net.Listener, error) {
+	if s.cfg.Socket == "" {
+		ln, err := net.Listen("tcp", s.cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("listening on %s: %w", s.cfg.Addr, err)
+		}
+		return ln, nil
+	}
+
+	if info, err := os.Lstat(s.cfg.Socket); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(s.cfg.Socket); err != nil {
+			return nil, fmt.Errorf("removing stale socket %s: %w", s.cfg.Socket, err)
+		}
+	}
+	ln, err := net.Listen("unix", s.cfg.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("listening on socket %s: %w", s.cfg.Socket, err)
+	}
+	return ln, nil
+}
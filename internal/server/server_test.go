@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("HTTP_ADDR", "127.0.0.1:8081")
+	t.Setenv("HTTP_WRITE_TIMEOUT", "2m")
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v", err)
+	}
+	if cfg.Addr != "127.0.0.1:8081" || cfg.WriteTimeout != 2*time.Minute || cfg.ReadTimeout != DefaultConfig.ReadTimeout || cfg.TLS() {
+		t.Errorf("FromEnv() = %+v", cfg)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "set together") {
+		t.Errorf("FromEnv() with only a certificate error = %v", err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+	if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT") {
+		t.Errorf("FromEnv() with an invalid duration error = %v", err)
+	}
+}
+
+func TestRunUnixSocketDrain(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	cfg := DefaultConfig
+	cfg.Socket = socket
+	cfg.AdminAddr = "127.0.0.1:0"
+	cfg.DrainDelay = 50 * time.Millisecond
+
+	// A slow request in flight when shutdown starts must still be answered.
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	srv, err := New(cfg, handler, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var drained atomic.Bool
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx, func() { drained.Store(true) }) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	body := make(chan string, 1)
+	go func() {
+		for {
+			resp, err := client.Get("http://axfr/slow")
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body <- string(b)
+			return
+		}
+	}()
+
+	<-started
+	cancel()
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight response = %q, want done", got)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !drained.Load() {
+		t.Error("drain was not called")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after shutdown: %v", err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+
+	writeCert(t, certFile, keyFile, "second")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("certificate after reload = %s, want second", got)
+	}
+
+	// A broken pair must not replace the active certificate.
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload() of an invalid key succeeded")
+	}
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("certificate after failed reload = %s, want second", got)
+	}
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func writeCert(t *testing.T, certFile string, keyFile string, cn string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+// CertReloader serves a certificate loaded from disk and swaps it atomically on reload, so renewed
+// certificates are picked up without dropping connections.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	current  atomic.Pointer[tls.Certificate]
+}
+
+// NewCertReloader loads the key pair and fails if it is invalid.
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the key pair. On error the previous certificate stays active.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS key pair %s: %w", r.certFile, err)
+	}
+	r.current.Store(&cert)
+	return nil
+}
+
+// GetCertificate is the tls.Config hook returning the active certificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current.Load(), nil
+}
+
+// ReloadOnSignal reloads the key pair every time one of sig is received until stop is called.
+func (r *CertReloader) ReloadOnSignal(sig ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case s := <-ch:
+				if err := r.Reload(); err != nil {
+					slog.Error("TLS certificate reload failed, keeping previous certificate", slog.String("signal", s.String()), slog.Any("error", err))
+					continue
+				}
+				slog.Info("TLS certificate reloaded", slog.String("signal", s.String()), slog.String("cert", r.certFile))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,12 @@
+-- API keys for the mysql auth backend. key_sha256 is the hex SHA-256 of the key sent by clients,
+-- scopes a comma-separated list (admin, bulk). Quotas of 0 are unlimited.
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `key_sha256` char(64) NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `daily_quota` bigint(20) NOT NULL DEFAULT 0,
+  `monthly_quota` bigint(20) NOT NULL DEFAULT 0,
+  `scopes` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`key_sha256`),
+  UNIQUE KEY `api_keys_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
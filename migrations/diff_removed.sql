@@ -0,0 +1,11 @@
+-- Adds removal tracking to an existing diff database (dates + domains).
+-- removed mirrors domains: one row per domain that left the zone on dates.date.
+ALTER TABLE `dates` ADD COLUMN `removed` int(11) NOT NULL DEFAULT 0 AFTER `amount`;
+
+CREATE TABLE IF NOT EXISTS `removed` (
+  `dategrp` int(11) DEFAULT NULL,
+  `domain` varchar(255) DEFAULT NULL,
+  KEY `removed_dategrpdomainindex` (`dategrp`,`domain`),
+  KEY `removed_domain_idx` (`domain`),
+  KEY `removed_dategrp_idx` (`dategrp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
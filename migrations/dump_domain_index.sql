@@ -0,0 +1,3 @@
+-- Indexes the domain column of an existing dump database.
+-- /history looks a domain up by name to report whether it is still registered.
+ALTER TABLE `domains` ADD KEY `domain_idx` (`domain`);
@@ -16,6 +16,7 @@ CREATE TABLE `dates` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `date` int(11) DEFAULT NULL,
   `amount` int(11) DEFAULT NULL,
+  `removed` int(11) NOT NULL DEFAULT 0,
   PRIMARY KEY (`id`),
   KEY `dateamountindex` (`date`,`amount`),
   KEY `date_idx` (`date`)
@@ -24,7 +25,7 @@ CREATE TABLE `dates` (
 
 LOCK TABLES `dates` WRITE;
 /*!40000 ALTER TABLE `dates` DISABLE KEYS */;
-INSERT INTO `dates` (`id`, `date`, `amount`) VALUES (971,20250314,44);
+INSERT INTO `dates` (`id`, `date`, `amount`, `removed`) VALUES (971,20250314,44,3);
 /*!40000 ALTER TABLE `dates` ENABLE KEYS */;
 UNLOCK TABLES;
 
@@ -45,6 +46,24 @@ LOCK TABLES `domains` WRITE;
 INSERT INTO `domains` (`dategrp`, `domain`) VALUES (971,'badrumonline.nu'),(971,'badrumsdeal.nu'),(971,'badrumsproffs.nu'),(971,'bedrijfsenergievergelijker.nu'),(971,'capisco.nu'),(971,'danser.nu'),(971,'digitalisering.nu'),(971,'elkem.nu'),(971,'fx8.nu'),(971,'gillabyran.nu'),(971,'gocapisco.nu'),(971,'hazen.nu'),(971,'hhab.nu'),(971,'intagsservice.nu'),(971,'jii.nu'),(971,'jonah.nu'),(971,'jouwadvocaat.nu'),(971,'legendslive.nu'),(971,'lunchdags.nu'),(971,'marklinder.nu'),(971,'mdsab.nu'),(971,'movemind.nu'),(971,'oemaayah.nu'),(971,'profixsverige.nu'),(971,'projektera.nu'),(971,'promeet.nu'),(971,'protreptik.nu'),(971,'rum13.nu'),(971,'scouting.nu'),(971,'sinme.nu'),(971,'slackline.nu'),(971,'snall.nu'),(971,'stroomvoorbedrijven.nu'),(971,'swecanab.nu'),(971,'swedshop.nu'),(971,'tagrensning.nu'),(971,'texas-holdem.nu'),(971,'vetterberg.nu'),(971,'vkproffsen.nu'),(971,'werkenmettrauma.nu'),(971,'xn--allamssor-z2a.nu'),(971,'xn--gillabyrn-d3a.nu'),(971,'xn--hemstd-fua.nu'),(971,'zakrisson.nu');
 /*!40000 ALTER TABLE `domains` ENABLE KEYS */;
 UNLOCK TABLES;
+
+DROP TABLE IF EXISTS `removed`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+ SET character_set_client = utf8mb4 ;
+CREATE TABLE `removed` (
+  `dategrp` int(11) DEFAULT NULL,
+  `domain` varchar(255) DEFAULT NULL,
+  KEY `removed_dategrpdomainindex` (`dategrp`,`domain`),
+  KEY `removed_domain_idx` (`domain`),
+  KEY `removed_dategrp_idx` (`dategrp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+LOCK TABLES `removed` WRITE;
+/*!40000 ALTER TABLE `removed` DISABLE KEYS */;
+INSERT INTO `removed` (`dategrp`, `domain`) VALUES (971,'gammal.nu'),(971,'nedlagd.nu'),(971,'utgangen.nu');
+/*!40000 ALTER TABLE `removed` ENABLE KEYS */;
+UNLOCK TABLES;
 /*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
 
 /*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
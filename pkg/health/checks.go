@@ -4,16 +4,16 @@ import (
 	"fmt"
 	"go-axfr-backend/internal/database"
 	"go-axfr-backend/internal/models"
-	"log"
+	"log/slog"
 	"net"
 	"time"
 )
 
 func CheckDatabases(dbs []models.DbConfig) error {
 	for _, cfg := range dbs {
-		conn, err := database.Connect(cfg.Database, cfg.Username, cfg.Password)
+		conn, err := database.ConnectTo(cfg.Host, cfg.Database, cfg.Username, cfg.Password)
 		if err != nil {
-			log.Printf("Error connecting to %s database: %v", cfg.DbName, err)
+			slog.Error("database health check failed", slog.String("database", cfg.DbName), slog.Any("error", err))
 			return fmt.Errorf("failed to connect to %s database: %v", cfg.DbName, err)
 		}
 		defer conn.Close()